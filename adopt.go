@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// adoptBinary registers a binary installed without obt in the history, so
+// -U can update it.
+func adoptBinary(stdout, stderr io.Writer, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New("please specify a binary. Usage: obt adopt <path> [repo]")
+	}
+
+	file, err := filepath.Abs(args[0])
+	if err != nil {
+		return err
+	}
+	if fi, err := os.Stat(file); err != nil || !fi.Mode().IsRegular() {
+		return fmt.Errorf("'%s' isn't a file", file)
+	}
+
+	hf := HistoryFile{filename: determineHistoryFilePath()}
+	if histories, err := hf.load(); err == nil {
+		if _, ok := histories[file]; ok {
+			return fmt.Errorf("'%s' is already managed by obt", file)
+		}
+	}
+
+	h := &History{Path: file, BinaryName: strings.TrimSuffix(filepath.Base(file), ".exe")}
+	version := ""
+	if info, ok := historyFromBuildInfo(file); ok {
+		h.URL = info.URL
+		version = info.Tag
+	}
+
+	if len(args) == 2 {
+		url, _, _, ok := parseRepositoryURL(args[1])
+		if !ok {
+			return fmt.Errorf("invalid repository '%s'", args[1])
+		}
+		if !strings.Contains(url, "://") {
+			url = "https://github.com/" + url
+		}
+		h.URL = url
+	}
+
+	if len(h.URL) == 0 {
+		return fmt.Errorf("can't infer the repository of '%s'. Please specify it: obt adopt %s owner/repo", file, args[0])
+	}
+
+	if len(version) == 0 {
+		version = probeVersion(file, "--version")
+	}
+
+	if len(version) == 0 {
+		fmt.Fprintf(stderr, "warning: can't find the version of '%s'. '-U' installs the latest release.\n", file)
+	} else {
+		_, user, repository, _ := parseRepositoryURL(h.URL)
+		d := Downloader{user: user, repository: repository, cachePath: determineCachePath()}
+		tag, err := d.findReleaseTag(version)
+		if err != nil {
+			fmt.Fprintf(stderr, "warning: no release of '%s' matches version '%s' (%v). '-U' installs the latest release.\n", h.URL, version, err)
+		}
+		h.Tag = tag
+	}
+
+	addFileMetadata(h, file)
+	h.Host = hostOf(h.URL)
+
+	err = hf.update(func(histories map[string]*History) error {
+		putHistory(histories, h)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeReceipt(h); err != nil {
+		fmt.Fprintf(stderr, "receipt save error %v\n", err)
+	}
+
+	tag := h.Tag
+	if len(tag) == 0 {
+		tag = "unknown version"
+	}
+	fmt.Fprintf(stdout, "Adopt '%s' as '%s(%s)'.\n", file, h.URL, tag)
+	return nil
+}
+
+// findReleaseTag returns the tag of the release for version, e.g. "v1.2.3"
+// or "tool-1.2.3" for "1.2.3".
+func (d *Downloader) findReleaseTag(version string) (string, error) {
+	client := d.newGitHubClient()
+	opt := &github.ListOptions{PerPage: 100}
+
+	var tags []string
+	for {
+		releases, resp, err := client.Repositories.ListReleases(context.Background(), d.user, d.repository, opt)
+		if err != nil {
+			return "", err
+		}
+		for _, r := range releases {
+			tags = append(tags, r.GetTagName())
+		}
+
+		// Stop once a release matches, so old releases are found page by page.
+		if _, ok := matchReleaseTag(tags, version); ok || resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	tag, ok := matchReleaseTag(tags, version)
+	if !ok {
+		return "", errors.New("no matching tag")
+	}
+	return tag, nil
+}
+
+func matchReleaseTag(tags []string, version string) (string, bool) {
+	version = strings.TrimPrefix(version, "v")
+
+	for _, tag := range tags {
+		if strings.TrimPrefix(tag, "v") == version {
+			return tag, true
+		}
+	}
+
+	// Tags with a prefix like "tool-v1.2.3" or "release/1.2.3".
+	for _, tag := range tags {
+		i := strings.LastIndexAny(tag, "-/_@")
+		if i >= 0 && strings.TrimPrefix(tag[i+1:], "v") == version {
+			return tag, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestMatchReleaseTag(t *testing.T) {
+	tags := []string{"v2.0.0", "v1.2.3", "tool-v1.1.0", "release/1.0.0"}
+
+	tests := []struct {
+		version string
+		want    string
+		ok      bool
+	}{
+		{"1.2.3", "v1.2.3", true},
+		{"v2.0.0", "v2.0.0", true},
+		{"1.1.0", "tool-v1.1.0", true},
+		{"v1.0.0", "release/1.0.0", true},
+		{"0.9.0", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := matchReleaseTag(tags, tt.version)
+		if got != tt.want || ok != tt.ok {
+			t.Fatalf("version: '%v', expected '%v' (%v), got '%v' (%v)", tt.version, tt.want, tt.ok, got, ok)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+var appImageMagic = []byte("AI\x02")
+
+// isAppImage reports whether file is a type 2 AppImage, an ELF runtime with
+// "AI\x02" at offset 8 followed by a squashfs payload.
+func isAppImage(file string) bool {
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	head := make([]byte, 11)
+	if _, err := f.Read(head); err != nil {
+		return false
+	}
+
+	return bytes.HasPrefix(head, []byte("\x7fELF")) && bytes.Equal(head[8:11], appImageMagic)
+}
+
+// extractAppImagePayload unpacks the squashfs payload of an AppImage into
+// the data directory and replaces file with a link to its AppRun, so the
+// tool works on hosts without FUSE.
+func (d *Downloader) extractAppImagePayload(file string) error {
+	if d.targetOS() != runtime.GOOS || d.targetArch() != runtime.GOARCH {
+		return errors.New("an AppImage can only be extracted for the running OS and architecture")
+	}
+	if len(d.dataPath) == 0 {
+		return errors.New("can't extract an AppImage without a data path")
+	}
+
+	tempDir, err := os.MkdirTemp("", cmd)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	// The AppImage runtime extracts itself without FUSE.
+	c := exec.Command(file, "--appimage-extract")
+	c.Dir = tempDir
+	if out, err := c.CombinedOutput(); err != nil {
+		return fmt.Errorf("AppImage extraction failed: %v: %s", err, out)
+	}
+
+	appDir := filepath.Join(d.dataPath, "appimages", d.installName())
+	if err := os.MkdirAll(filepath.Dir(appDir), 0755); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(appDir); err != nil {
+		return err
+	}
+	if err := os.Rename(filepath.Join(tempDir, "squashfs-root"), appDir); err != nil {
+		return err
+	}
+
+	appRun := filepath.Join(appDir, "AppRun")
+	if _, err := os.Stat(appRun); err != nil {
+		return fmt.Errorf("extracted AppImage has no AppRun: %v", err)
+	}
+
+	if err := os.Remove(file); err != nil {
+		return err
+	}
+	return os.Symlink(appRun, file)
+}
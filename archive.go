@@ -0,0 +1,282 @@
+package main
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+const maxLinkDepth = 16
+
+type archiveEntry struct {
+	name     string
+	mode     fs.FileMode
+	linkname string
+	hardlink bool
+	open     func() ([]byte, error)
+}
+
+func (e *archiveEntry) isLink() bool {
+	return e.hardlink || e.mode&fs.ModeSymlink != 0
+}
+
+// target returns the archive path a link entry points to.
+func (e *archiveEntry) target() string {
+	if e.hardlink || strings.HasPrefix(e.linkname, "/") {
+		return cleanEntryName(e.linkname)
+	}
+	return cleanEntryName(path.Join(path.Dir(e.name), e.linkname))
+}
+
+func cleanEntryName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// matchEntry reports whether an archive entry is the binary to install. With
+// a path glob only the full entry path is compared, otherwise the base name.
+func (d *Downloader) matchEntry(name string) bool {
+	if len(d.pathInArchive) != 0 {
+		ok, _ := path.Match(cleanEntryName(d.pathInArchive), cleanEntryName(name))
+		return ok
+	}
+	return d.isBinaryEntry(name)
+}
+
+func (d *Downloader) extractTar(r io.Reader, file string) error {
+	return d.extractTarMatching(r, file, d.matchEntry)
+}
+
+// extractTarMatching reads a tar stream once. Matching entries are kept in
+// memory. Other executable files, which links usually point to, are spooled
+// to a temporary directory.
+func (d *Downloader) extractTarMatching(r io.Reader, file string, match func(string) bool) error {
+	tr := tar.NewReader(r)
+	var entries []*archiveEntry
+	spool := &entrySpool{}
+	defer spool.remove()
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := d.countEntry(); err != nil {
+			return err
+		}
+
+		e := &archiveEntry{name: cleanEntryName(hdr.Name), mode: hdr.FileInfo().Mode(), linkname: hdr.Linkname}
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			kept, err := d.keepEntry(e, tr, hdr.Size, match(hdr.Name), spool)
+			if err != nil {
+				return err
+			}
+			if !kept {
+				continue
+			}
+		case tar.TypeLink:
+			e.hardlink = true
+		case tar.TypeSymlink:
+		default:
+			continue
+		}
+
+		entries = append(entries, e)
+	}
+
+	return d.installEntry(entries, file, match)
+}
+
+// entrySpool is a temporary directory for entries of a stream that may be
+// link targets. It's created on first use.
+type entrySpool struct {
+	dir string
+}
+
+func (s *entrySpool) remove() {
+	if len(s.dir) != 0 {
+		os.RemoveAll(s.dir)
+	}
+}
+
+// keepEntry keeps the data of a regular entry of a stream, so it can be read
+// after the stream moved on. Matching entries are kept in memory, other
+// executable files are spooled. Other files aren't kept, and false is
+// returned.
+func (d *Downloader) keepEntry(e *archiveEntry, r io.Reader, size int64, matched bool, spool *entrySpool) (bool, error) {
+	if matched {
+		bs, err := d.readEntry(e.name, r, size)
+		if err != nil {
+			return false, err
+		}
+		e.open = func() ([]byte, error) { return bs, nil }
+		return true, nil
+	}
+
+	if e.mode&0111 == 0 {
+		return false, nil
+	}
+
+	if len(spool.dir) == 0 {
+		dir, err := os.MkdirTemp("", "obt-archive")
+		if err != nil {
+			return false, err
+		}
+		spool.dir = dir
+	}
+
+	open, err := d.spoolEntry(spool.dir, e.name, r, size)
+	if err != nil {
+		return false, err
+	}
+	e.open = open
+	return true, nil
+}
+
+// spoolEntry copies an entry to a file in dir and returns a function to read
+// it back.
+func (d *Downloader) spoolEntry(dir, name string, r io.Reader, size int64) (func() ([]byte, error), error) {
+	if err := d.checkEntrySize(name, size); err != nil {
+		return nil, err
+	}
+
+	f, err := os.CreateTemp(dir, "entry")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	max := d.sizeGuard().limits.MaxEntrySize
+	n, err := io.Copy(f, io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if n > max {
+		return nil, d.checkEntrySize(name, n)
+	}
+
+	spooled := f.Name()
+	return func() ([]byte, error) { return os.ReadFile(spooled) }, nil
+}
+
+// newLazyEntry creates an entry of a random access archive like zip or 7z.
+// Only the link target is read up front.
+func (d *Downloader) newLazyEntry(name string, mode fs.FileMode, size int64, open func() (io.ReadCloser, error)) (*archiveEntry, error) {
+	e := &archiveEntry{name: cleanEntryName(name), mode: mode}
+	e.open = func() ([]byte, error) {
+		r, err := open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+
+		return d.readEntry(name, d.guardExpanded(r), size)
+	}
+
+	if mode&fs.ModeSymlink != 0 {
+		b, err := e.open()
+		if err != nil {
+			return nil, err
+		}
+		e.linkname = string(b)
+	}
+
+	return e, nil
+}
+
+func (d *Downloader) installEntry(entries []*archiveEntry, file string, match func(string) bool) error {
+	e, err := selectArchiveEntry(entries, match)
+	if err != nil {
+		return err
+	}
+
+	bs, err := e.open()
+	if err != nil {
+		return err
+	}
+
+	return d.writeFileMode(file, bs, e.mode.Perm())
+}
+
+// selectArchiveEntry finds the single entry matching the binary and resolves
+// symlinks and hard links to the regular file they point to.
+func selectArchiveEntry(entries []*archiveEntry, match func(string) bool) (*archiveEntry, error) {
+	byName := map[string]*archiveEntry{}
+	for _, e := range entries {
+		byName[e.name] = e
+	}
+
+	resolved := map[string]*archiveEntry{}
+	var names []string
+	for _, e := range entries {
+		if !match(e.name) {
+			continue
+		}
+
+		target, err := resolveArchiveEntry(e, byName)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := resolved[target.name]; !ok {
+			names = append(names, e.name)
+		}
+		resolved[target.name] = target
+	}
+
+	switch len(resolved) {
+	case 0:
+		return nil, errors.New("can't install released binary. This is a possibility that bug of `obt`. Please report an issue")
+	case 1:
+		for _, e := range resolved {
+			return e, nil
+		}
+	}
+
+	sort.Strings(names)
+	return nil, fmt.Errorf("the archive has several entries for the binary:\n  %s\nPlease choose one with '-path-in-archive'", strings.Join(names, "\n  "))
+}
+
+func resolveArchiveEntry(e *archiveEntry, byName map[string]*archiveEntry) (*archiveEntry, error) {
+	for i := 0; i < maxLinkDepth; i++ {
+		if !e.isLink() {
+			if e.open == nil {
+				return nil, fmt.Errorf("can't read '%s' in the archive", e.name)
+			}
+			return e, nil
+		}
+
+		target, ok := byName[e.target()]
+		if !ok {
+			return nil, fmt.Errorf("'%s' links to '%s', which isn't in the archive", e.name, e.linkname)
+		}
+		e = target
+	}
+
+	return nil, fmt.Errorf("too many levels of links for '%s'", e.name)
+}
+
+// writeFileMode installs b with the permission bits of the entry. The file is
+// always executable by whoever can read it and only writable by the owner,
+// since zips made on Windows or by Go's zip.Writer report 0666.
+func (d *Downloader) writeFileMode(file string, b []byte, mode fs.FileMode) error {
+	mode = mode.Perm()
+	if mode == 0 {
+		mode = 0755
+	}
+	mode = (mode | 0100 | (mode&0444)>>2) &^ 0022
+
+	if err := d.writeFile(file, b); err != nil {
+		return err
+	}
+	return os.Chmod(file, mode)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"debug/elf"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type binaryInfo struct {
+	format      string
+	machine     string
+	static      bool
+	interpreter string
+}
+
+func (i *binaryInfo) String() string {
+	if i.format == "script" {
+		return fmt.Sprintf("script (%s)", i.interpreter)
+	}
+	if i.static {
+		return fmt.Sprintf("statically linked %s %s binary", i.format, i.machine)
+	}
+	return fmt.Sprintf("dynamically linked %s %s binary (interpreter: %s)", i.format, i.machine, i.interpreter)
+}
+
+var elfMachines = map[string]elf.Machine{
+	"amd64":    elf.EM_X86_64,
+	"386":      elf.EM_386,
+	"arm64":    elf.EM_AARCH64,
+	"arm":      elf.EM_ARM,
+	"ppc64":    elf.EM_PPC64,
+	"ppc64le":  elf.EM_PPC64,
+	"s390x":    elf.EM_S390,
+	"riscv64":  elf.EM_RISCV,
+	"mips":     elf.EM_MIPS,
+	"mipsle":   elf.EM_MIPS,
+	"mips64":   elf.EM_MIPS,
+	"mips64le": elf.EM_MIPS,
+}
+
+var elfOSABIs = map[string][]elf.OSABI{
+	"linux":   {elf.ELFOSABI_NONE, elf.ELFOSABI_LINUX},
+	"android": {elf.ELFOSABI_NONE, elf.ELFOSABI_LINUX},
+	"freebsd": {elf.ELFOSABI_FREEBSD},
+	"netbsd":  {elf.ELFOSABI_NONE, elf.ELFOSABI_NETBSD},
+	"openbsd": {elf.ELFOSABI_NONE, elf.ELFOSABI_OPENBSD},
+}
+
+func elfData(goarch string) elf.Data {
+	switch goarch {
+	case "ppc64", "mips", "mips64", "s390x":
+		return elf.ELFDATA2MSB
+	}
+	return elf.ELFDATA2LSB
+}
+
+func elfClass(goarch string) elf.Class {
+	if strings.HasSuffix(goarch, "64") || strings.HasSuffix(goarch, "64le") || goarch == "s390x" {
+		return elf.ELFCLASS64
+	}
+	return elf.ELFCLASS32
+}
+
+// inspectELF checks that file is an ELF binary that runs on goos/goarch.
+func inspectELF(file, goos, goarch string) (*binaryInfo, error) {
+	f, err := elf.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	target := goos + "/" + goarch
+	if machine, ok := elfMachines[goarch]; ok && f.Machine != machine {
+		return nil, fmt.Errorf("downloaded binary is built for %v, but the target is %s", f.Machine, target)
+	}
+
+	if data := elfData(goarch); f.Data != data {
+		return nil, fmt.Errorf("downloaded binary is %v, but the target %s needs %v", f.Data, target, data)
+	}
+
+	if class := elfClass(goarch); f.Class != class {
+		return nil, fmt.Errorf("downloaded binary is %v, but the target %s needs %v", f.Class, target, class)
+	}
+
+	if abis, ok := elfOSABIs[goos]; ok && !containsOSABI(abis, f.OSABI) {
+		return nil, fmt.Errorf("downloaded binary is built for %v, but the target is %s", f.OSABI, target)
+	}
+
+	interpreter, err := interpreterOf(f)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &binaryInfo{format: "ELF", machine: goarch, static: len(interpreter) == 0, interpreter: interpreter}
+	return info, nil
+}
+
+func containsOSABI(abis []elf.OSABI, abi elf.OSABI) bool {
+	for _, v := range abis {
+		if v == abi {
+			return true
+		}
+	}
+	return false
+}
+
+func elfInterpreter(file string) (string, error) {
+	f, err := elf.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	return interpreterOf(f)
+}
+
+func interpreterOf(f *elf.File) (string, error) {
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_INTERP {
+			continue
+		}
+
+		b, err := io.ReadAll(prog.Open())
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(b), "\x00"), nil
+	}
+
+	return "", nil
+}
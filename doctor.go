@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+
+	"github.com/y-yagi/goext/osext"
+)
+
+// maxCacheSize is the size of the cache directory reported as too large.
+const maxCacheSize = 500 << 20
+
+type problem struct {
+	message string
+	fix     string
+	warning bool
+}
+
+type Doctor struct {
+	stdout          io.Writer
+	installPath     string
+	historyFilePath string
+	cachePath       string
+	pathEnv         string
+}
+
+func newDoctor(stdout io.Writer) Doctor {
+	return Doctor{stdout: stdout, installPath: cfg.Path, historyFilePath: determineHistoryFilePath(), cachePath: determineCachePath(), pathEnv: os.Getenv("PATH")}
+}
+
+// execute runs every check and returns an error when one of them finds a
+// problem. Warnings are only printed.
+func (dr *Doctor) execute() error {
+	checks := []struct {
+		name string
+		fn   func() []problem
+	}{
+		{"install path", dr.checkInstallPath},
+		{"PATH", dr.checkPathEnv},
+		{"history", dr.checkHistory},
+		{"cache", dr.checkCache},
+		{"GitHub token", dr.checkToken},
+	}
+
+	failures := 0
+	for _, c := range checks {
+		problems := c.fn()
+		if len(problems) == 0 {
+			fmt.Fprintf(dr.stdout, "[OK]   %s\n", c.name)
+			continue
+		}
+
+		for _, p := range problems {
+			label := "[NG]  "
+			if p.warning {
+				label = "[WARN]"
+			} else {
+				failures++
+			}
+			fmt.Fprintf(dr.stdout, "%s %s: %s\n", label, c.name, p.message)
+			fmt.Fprintf(dr.stdout, "       fix: %s\n", p.fix)
+		}
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("%d problems found", failures)
+	}
+	return nil
+}
+
+func (dr *Doctor) checkInstallPath() []problem {
+	switch {
+	case len(dr.installPath) == 0:
+		return []problem{{message: "default install path isn't set", fix: "set it with 'obt -s /path/to/bin'"}}
+	case !filepath.IsAbs(dr.installPath):
+		return []problem{{message: fmt.Sprintf("'%s' isn't an absolute path", dr.installPath), fix: "set an absolute path with 'obt -s /path/to/bin'"}}
+	case !osext.IsExist(dr.installPath):
+		return []problem{{message: fmt.Sprintf("'%s' doesn't exist", dr.installPath), fix: fmt.Sprintf("create it with 'mkdir -p %s'", dr.installPath)}}
+	}
+
+	f, err := os.CreateTemp(dr.installPath, ".obt-doctor-*")
+	if err != nil {
+		return []problem{{message: fmt.Sprintf("'%s' isn't writable", dr.installPath), fix: fmt.Sprintf("make it writable, e.g. 'sudo chown $(id -un) %s', or change the install path with 'obt -s'", dr.installPath)}}
+	}
+	f.Close()
+	os.Remove(f.Name())
+
+	return nil
+}
+
+func (dr *Doctor) checkPathEnv() []problem {
+	if len(dr.installPath) == 0 {
+		return nil
+	}
+
+	for _, dir := range filepath.SplitList(dr.pathEnv) {
+		if len(dir) != 0 && filepath.Clean(dir) == filepath.Clean(dr.installPath) {
+			return nil
+		}
+	}
+
+	return []problem{{message: fmt.Sprintf("'%s' isn't in PATH, so installed binaries can't be run by name", dr.installPath), fix: fmt.Sprintf("add it to PATH in your shell profile, e.g. 'export PATH=\"%s:$PATH\"'", dr.installPath)}}
+}
+
+// checkHistory finds entries whose file is deleted and binaries shadowed by
+// another file with the same name earlier in PATH.
+func (dr *Doctor) checkHistory() []problem {
+	hf := HistoryFile{filename: dr.historyFilePath}
+	if !osext.IsExist(hf.filename) {
+		return nil
+	}
+
+	histories, err := hf.load()
+	if err != nil {
+		return []problem{{message: err.Error(), fix: "run 'obt history repair'"}}
+	}
+
+	keys := make([]string, 0, len(histories))
+	for k := range histories {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var problems []problem
+	checked := map[string]bool{}
+	for _, k := range keys {
+		h := histories[k]
+		if !osext.IsExist(h.installedFile()) {
+			problems = append(problems, problem{message: fmt.Sprintf("'%s' in the history is deleted", h.installedFile()), fix: "reinstall it with 'obt verify -fix', or remove it with 'obt history prune'"})
+			continue
+		}
+
+		if checked[h.Path] {
+			continue
+		}
+		checked[h.Path] = true
+
+		found := lookPath(filepath.Base(h.Path), dr.pathEnv)
+		if len(found) == 0 || isSameFile(found, h.Path) {
+			continue
+		}
+		problems = append(problems, problem{message: fmt.Sprintf("'%s' runs '%s' instead of '%s'", filepath.Base(h.Path), found, h.Path), fix: fmt.Sprintf("remove '%s', or put '%s' before '%s' in PATH", found, filepath.Dir(h.Path), filepath.Dir(found))})
+	}
+
+	return problems
+}
+
+func (dr *Doctor) checkCache() []problem {
+	if len(dr.cachePath) == 0 {
+		return nil
+	}
+
+	size, err := dirSize(dr.cachePath)
+	if err != nil || size <= maxCacheSize {
+		return nil
+	}
+
+	return []problem{{message: fmt.Sprintf("'%s' uses %s", dr.cachePath, formatSize(size)), fix: fmt.Sprintf("remove '%s'. Release data is fetched again when needed", dr.cachePath), warning: true}}
+}
+
+func (dr *Doctor) checkToken() []problem {
+	if len(githubToken()) != 0 {
+		return nil
+	}
+
+	return []problem{{message: "GITHUB_TOKEN isn't set. Requests to GitHub are limited to 60 per hour", fix: "create a token at https://github.com/settings/tokens and set it to GITHUB_TOKEN", warning: true}}
+}
+
+// lookPath returns the first executable file named name in pathEnv.
+func lookPath(name, pathEnv string) string {
+	for _, dir := range filepath.SplitList(pathEnv) {
+		if len(dir) == 0 {
+			continue
+		}
+
+		file := filepath.Join(dir, name)
+		fi, err := os.Stat(file)
+		if err == nil && !fi.IsDir() && (runtime.GOOS == "windows" || fi.Mode()&0111 != 0) {
+			return file
+		}
+	}
+	return ""
+}
+
+func isSameFile(a, b string) bool {
+	fa, errA := os.Stat(a)
+	fb, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(fa, fb)
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, e fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if e.Type().IsRegular() {
+			fi, err := e.Info()
+			if err == nil {
+				size += fi.Size()
+			}
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDoctor(t *testing.T) {
+	tempDir := t.TempDir()
+	bin := filepath.Join(tempDir, "bin")
+	system := filepath.Join(tempDir, "system")
+	for _, dir := range []string{bin, system} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hf := HistoryFile{filename: filepath.Join(tempDir, "history")}
+	for _, name := range []string{"tool", "deleted"} {
+		file := filepath.Join(bin, name)
+		if err := os.WriteFile(file, []byte(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := hf.save(Downloader{releaseTag: "v1.0.0"}, "https://github.com/owner/"+name, file, "", name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Remove(filepath.Join(bin, "deleted"))
+
+	t.Setenv("GITHUB_TOKEN", "token")
+	dr := Doctor{stdout: new(bytes.Buffer), installPath: bin, historyFilePath: hf.filename, pathEnv: bin}
+	stdout := dr.stdout.(*bytes.Buffer)
+
+	err := dr.execute()
+	if err == nil || err.Error() != "1 problems found" || !strings.Contains(stdout.String(), "'"+filepath.Join(bin, "deleted")+"' in the history is deleted") {
+		t.Fatalf("expected a deleted file to be found, got %v:\n%s", err, stdout)
+	}
+
+	// A file earlier in PATH shadows the installed one.
+	if err := os.WriteFile(filepath.Join(system, "tool"), []byte("old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		pathEnv string
+		want    string
+	}{
+		{system + string(os.PathListSeparator) + bin, "'tool' runs '" + filepath.Join(system, "tool") + "' instead of"},
+		{system, "'" + bin + "' isn't in PATH"},
+	}
+
+	for _, tt := range tests {
+		stdout.Reset()
+		dr.pathEnv = tt.pathEnv
+		if err := dr.execute(); err == nil || !strings.Contains(stdout.String(), tt.want) {
+			t.Fatalf("PATH: '%v', expected '%v', got %v:\n%s", tt.pathEnv, tt.want, err, stdout)
+		}
+	}
+
+	stdout.Reset()
+	t.Setenv("GITHUB_TOKEN", "")
+	t.Setenv("GH_TOKEN", "")
+	dr = Doctor{stdout: stdout, installPath: filepath.Join(tempDir, "none"), historyFilePath: filepath.Join(tempDir, "none"), pathEnv: bin}
+	dr.execute()
+	if !strings.Contains(stdout.String(), "doesn't exist") || !strings.Contains(stdout.String(), "[WARN] GitHub token") {
+		t.Fatalf("unexpected output:\n%s", stdout)
+	}
+}
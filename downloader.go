@@ -1,9 +1,10 @@
 package main
 
 import (
-	"archive/tar"
 	"archive/zip"
+	"bufio"
 	"bytes"
+	"compress/bzip2"
 	"compress/gzip"
 	"context"
 	"errors"
@@ -15,10 +16,12 @@ import (
 	"runtime"
 	"strings"
 
+	"github.com/bodgit/sevenzip"
 	"github.com/google/go-github/github"
 	"github.com/gregjones/httpcache"
 	"github.com/gregjones/httpcache/diskcache"
 	"github.com/h2non/filetype"
+	"github.com/klauspost/compress/zstd"
 	"github.com/ulikunitz/xz"
 )
 
@@ -31,103 +34,206 @@ const (
 	zipType
 	tarXzType
 	xzType
+	tarBz2Type
+	bz2Type
+	tarZstType
+	zstType
+	sevenZipType
+	debType
+	rpmType
+	appImageType
 )
 
+var fileTypeNames = []string{"binary", "tar.gz", "gz", "zip", "tar.xz", "xz", "tar.bz2", "bz2", "tar.zst", "zst", "7z", "deb", "rpm", "AppImage"}
+
+func (t fileType) String() string {
+	if int(t) < len(fileTypeNames) {
+		return fileTypeNames[t]
+	}
+	return "unknown"
+}
+
 type Downloader struct {
-	user       string
-	repository string
-	url        string
-	binaryName string
-	fType      fileType
-	cachePath  string
-	releaseTag string
+	user          string
+	repository    string
+	url           string
+	binaryName    string
+	outputName    string
+	fType         fileType
+	cachePath     string
+	releaseTag    string
+	goos          string
+	goarch        string
+	libc          string
+	strictLibs    bool
+	dataPath      string
+	appImage      bool
+	allowScript   bool
+	portable      bool
+	pathInArchive string
+	limits        Limits
+	guard         *sizeGuard
+	assetSize     int64
+	stderr        io.Writer
+	assetName     string
+	candidates    []*assetCandidate
+	info          *binaryInfo
+	missing       []string
 }
 
-func (d *Downloader) findDownloadURL() error {
-	var client *github.Client
+// tokenTransport authenticates API requests, which raises the rate limit.
+type tokenTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return t.base.RoundTrip(req)
+}
+
+// githubToken returns the token from GITHUB_TOKEN or GH_TOKEN.
+func githubToken() string {
+	for _, name := range []string{"GITHUB_TOKEN", "GH_TOKEN"} {
+		if token := os.Getenv(name); len(token) != 0 {
+			return token
+		}
+	}
+	return ""
+}
+
+func (d *Downloader) newGitHubClient() *github.Client {
+	transport := http.DefaultTransport
+	if token := githubToken(); len(token) != 0 {
+		transport = &tokenTransport{token: token, base: transport}
+	}
 
 	if len(d.cachePath) != 0 {
-		client = github.NewClient(httpcache.NewTransport(diskcache.New(d.cachePath)).Client())
 		logger.Printf("use httpcache. path: %+v\n", d.cachePath)
-	} else {
-		client = github.NewClient(nil)
+		t := httpcache.NewTransport(diskcache.New(d.cachePath))
+		t.Transport = transport
+		return github.NewClient(t.Client())
 	}
 
-	var release *github.RepositoryRelease
-	var err error
+	return github.NewClient(&http.Client{Transport: transport})
+}
+
+func (d *Downloader) fetchRelease() (*github.RepositoryRelease, error) {
+	client := d.newGitHubClient()
 
 	if len(d.releaseTag) != 0 {
-		release, _, err = client.Repositories.GetReleaseByTag(context.Background(), d.user, d.repository, d.releaseTag)
-		if err != nil {
-			return err
-		}
-	} else {
-		release, _, err = client.Repositories.GetLatestRelease(context.Background(), d.user, d.repository)
-		if err != nil {
-			return err
-		}
+		release, _, err := client.Repositories.GetReleaseByTag(context.Background(), d.user, d.repository, d.releaseTag)
+		return release, err
+	}
 
-		logger.Printf("latest release : %+v\n", *release.TagName)
-		d.releaseTag = *release.TagName
+	release, _, err := client.Repositories.GetLatestRelease(context.Background(), d.user, d.repository)
+	if err != nil {
+		return nil, err
 	}
 
-	for _, asset := range release.Assets {
-		if len(d.binaryName) == 0 {
-			if strings.Contains(*asset.Name, d.repository) {
-				d.binaryName = d.repository
-			} else if a := strings.Split(*asset.Name, "_"); len(a) > 1 {
-				// TODO(y-yagi): Should I check all assets?
-				d.binaryName = a[0]
-			} else {
-				d.binaryName = d.repository
-			}
-		}
+	logger.Printf("latest release : %+v\n", *release.TagName)
+	d.releaseTag = *release.TagName
+	return release, nil
+}
+
+func (d *Downloader) findDownloadURL() error {
+	release, err := d.fetchRelease()
+	if err != nil {
+		return err
+	}
+
+	d.resolveTarget()
+	d.inferBinaryName(release.Assets)
+	d.candidates = d.rankAssets(release.Assets)
 
-		if d.isAvailableBinary(*asset.Name) {
-			d.url = *asset.BrowserDownloadURL
-			switch {
-			case strings.HasSuffix(*asset.Name, "tar.gz"):
-				d.fType = tarGzType
-			case strings.HasSuffix(*asset.Name, "gzip"):
-				d.fType = gzipType
-			case strings.HasSuffix(*asset.Name, "zip"):
-				d.fType = zipType
-			case strings.HasSuffix(*asset.Name, "tar.xz"):
-				d.fType = tarXzType
-			case strings.HasSuffix(*asset.Name, "xz"):
-				d.fType = xzType
-			case strings.HasSuffix(*asset.Name, "gz"):
-				d.fType = gzipType
-			default:
-				d.fType = binary
-			}
-
-			logger.Printf("download file from : %+v\n", d.url)
-			return nil
+	if len(d.candidates) > 0 && !d.candidates[0].rejected {
+		selected := d.candidates[0]
+		if p := aliases.parse(selected.name); len(p.libc) != 0 {
+			d.libc = p.libc
 		}
+		logger.Printf("selected asset : %+v (score: %d, %s)\n", selected.name, selected.score, strings.Join(selected.reasons, ", "))
+		d.assetName = selected.name
+		d.assetSize = int64(selected.size)
+		d.portable = selected.portable
+		d.url = selected.url
+		d.fType = fileTypeFromName(strings.ToLower(selected.name))
+		logger.Printf("download file from : %+v\n", d.url)
+		return nil
 	}
 
 	msg := fmt.Sprintf("can't find an available released binary. isn't the binary name '%s'?", d.binaryName)
 	return errors.New(msg)
 }
 
-func (d *Downloader) isAvailableBinary(assetName string) bool {
-	if !d.isSupportedFormat(assetName) {
-		return false
+func (d *Downloader) targetOS() string {
+	if len(d.goos) == 0 {
+		return runtime.GOOS
 	}
+	return d.goos
+}
+
+func (d *Downloader) targetArch() string {
+	if len(d.goarch) == 0 {
+		return runtime.GOARCH
+	}
+	return d.goarch
+}
+
+// executableName returns the file name of the binary on the target OS.
+func (d *Downloader) executableName() string {
+	if d.targetOS() == "windows" && !strings.HasSuffix(strings.ToLower(d.binaryName), ".exe") {
+		return d.binaryName + ".exe"
+	}
+	return d.binaryName
+}
 
-	assetName = strings.ReplaceAll(assetName, "-", "_")
-	prefix := strings.ReplaceAll(d.binaryName, "-", "_")
-	assetName = strings.ToLower(assetName)
-	switch runtime.GOARCH {
-	case "amd64":
-		assetName = strings.ReplaceAll(assetName, "x86_64", "amd64")
-		assetName = strings.ReplaceAll(assetName, "64bit", "amd64")
-	case "386":
-		assetName = strings.ReplaceAll(assetName, "x86", "386")
+// installName returns the file name to install the binary as. It differs
+// from the entry name in archives when an output name is given.
+func (d *Downloader) installName() string {
+	if len(d.outputName) == 0 {
+		return d.executableName()
+	}
+	if d.targetOS() == "windows" && !strings.HasSuffix(strings.ToLower(d.outputName), ".exe") {
+		return d.outputName + ".exe"
 	}
+	return d.outputName
+}
 
-	return strings.HasPrefix(assetName, prefix) && strings.Contains(assetName, runtime.GOOS) && strings.Contains(assetName, runtime.GOARCH)
+func (d *Downloader) isBinaryEntry(name string) bool {
+	base := filepath.Base(name)
+	return base == d.binaryName || base == d.executableName()
+}
+
+func (d *Downloader) resolveTarget() {
+	d.goos = d.targetOS()
+	d.goarch = d.targetArch()
+	d.binaryName = strings.TrimSuffix(d.binaryName, ".exe")
+
+	if len(d.libc) == 0 && d.goos == runtime.GOOS {
+		d.libc = detectLibc()
+		logger.Printf("detected libc : %+v\n", d.libc)
+	}
+}
+
+func (d *Downloader) inferBinaryName(assets []github.ReleaseAsset) {
+	if len(d.binaryName) != 0 || len(assets) == 0 {
+		return
+	}
+
+	// TODO(y-yagi): Should I check all assets?
+	name := strings.TrimSuffix(assets[0].GetName(), ".exe")
+	if strings.Contains(name, d.repository) {
+		d.binaryName = d.repository
+	} else if a := strings.Split(name, "_"); len(a) > 1 {
+		d.binaryName = a[0]
+	} else {
+		d.binaryName = d.repository
+	}
+}
+
+func (d *Downloader) isAvailableBinary(assetName string) bool {
+	return !d.scoreAsset(assetName).rejected
 }
 
 func (d *Downloader) execute(file string) error {
@@ -137,26 +243,97 @@ func (d *Downloader) execute(file string) error {
 	}
 	defer resp.Body.Close()
 
-	if err = d.download(&resp.Body, file); err != nil {
+	d.guard = nil
+	if max := d.sizeGuard().limits.MaxDownloadSize; resp.ContentLength > max {
+		return fmt.Errorf("'%s' has %d bytes, which is larger than the limit of %d bytes", d.assetName, resp.ContentLength, max)
+	}
+
+	// The download is written to a temporary file in the same directory and
+	// checked there, so a broken or wrong asset doesn't replace the binary
+	// already installed.
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return err
+	}
+
+	var body io.ReadCloser = io.NopCloser(d.guardDownload(resp.Body))
+	if err = d.download(&body, tmp.Name()); err != nil {
 		return err
 	}
 
-	fileIsBinary, err := d.isBinary(file)
+	if err = d.checkReceivedSize(body); err != nil {
+		return err
+	}
+
+	fileIsBinary, err := d.isBinary(tmp.Name())
 	if err != nil {
 		return err
 	}
 
 	if !fileIsBinary {
-		if err := os.Remove(file); err != nil {
+		return errors.New("downloaded file is not binary. This is a possibility that bug of `obt`. Please report an issue")
+	}
+
+	if err := d.checkSharedLibraries(tmp.Name()); err != nil {
+		return err
+	}
+
+	if d.info != nil && d.info.format == "AppImage" && d.appImage {
+		if err := d.extractAppImagePayload(tmp.Name()); err != nil {
 			return err
 		}
-		return errors.New("downloaded file is not binary. This is a possibility that bug of `obt`. Please report an issue")
 	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// checkSharedLibraries records missing libraries of the downloaded file and
+// fails in strict mode. The file isn't installed yet, so a failure keeps the
+// binary already installed.
+func (d *Downloader) checkSharedLibraries(file string) error {
+	if d.info == nil || d.info.static || d.info.format == "script" || d.targetOS() != runtime.GOOS || d.targetArch() != runtime.GOARCH {
+		return nil
+	}
+
+	missing, err := newLibraryResolver().missingLibraries(file)
+	if err != nil {
+		return err
+	}
+	d.missing = missing
+
+	if len(missing) == 0 || !d.strictLibs {
+		return nil
+	}
+	return fmt.Errorf("'%s' needs shared libraries that can't be found: %s.%s", d.binaryName, strings.Join(missing, ", "), d.alternativeAssetHint())
+}
+
+// alternativeAssetHint suggests a static or musl build from the same release,
+// which doesn't depend on the system libraries.
+func (d *Downloader) alternativeAssetHint() string {
+	for _, c := range d.candidates {
+		if c.rejected || c.name == d.assetName {
+			continue
+		}
 
-	return nil
+		if libc := aliases.parse(c.name).libc; libc == "static" || libc == "musl" {
+			return fmt.Sprintf(" The release also has '%s', which doesn't depend on the system libraries (try '-libc musl').", c.name)
+		}
+	}
+	return ""
 }
 
 func (d *Downloader) download(body *io.ReadCloser, file string) error {
+	br := bufio.NewReader(*body)
+	head, _ := br.Peek(262)
+	d.fType = detectFileType(head, d.fType)
+
+	var r io.ReadCloser = io.NopCloser(br)
+	body = &r
+
 	switch d.fType {
 	case tarGzType:
 		return d.downloadTarGz(body, file)
@@ -168,53 +345,79 @@ func (d *Downloader) download(body *io.ReadCloser, file string) error {
 		return d.downloadTarXz(body, file)
 	case xzType:
 		return d.downloadXz(body, file)
+	case tarBz2Type:
+		return d.downloadTarBz2(body, file)
+	case bz2Type:
+		return d.downloadBz2(body, file)
+	case tarZstType:
+		return d.downloadTarZst(body, file)
+	case zstType:
+		return d.downloadZst(body, file)
+	case sevenZipType:
+		return d.download7z(body, file)
+	case debType:
+		return d.downloadDeb(body, file)
+	case rpmType:
+		return d.downloadRpm(body, file)
 	}
 
 	return d.downloadBinary(body, file)
 }
 
-func (d *Downloader) downloadTarGz(body *io.ReadCloser, file string) error {
-	archive, err := gzip.NewReader(*body)
+// detectFileType checks the magic bytes of a download. The type guessed from
+// the asset name is kept unless the content says otherwise.
+func detectFileType(head []byte, byName fileType) fileType {
+	kind, err := filetype.Archive(head)
 	if err != nil {
-		return nil
+		return byName
 	}
 
-	tr := tar.NewReader(archive)
-
-	for {
-		hdr, err := tr.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil
-		}
-
-		if filepath.Base(hdr.Name) == d.binaryName {
-			bs, err := io.ReadAll(tr)
-			if err != nil {
-				return nil
-			}
+	var tarType, plainType fileType
+	switch kind.Extension {
+	case "gz":
+		tarType, plainType = tarGzType, gzipType
+	case "xz":
+		tarType, plainType = tarXzType, xzType
+	case "bz2":
+		tarType, plainType = tarBz2Type, bz2Type
+	case "zst":
+		tarType, plainType = tarZstType, zstType
+	case "zip":
+		return zipType
+	case "7z":
+		return sevenZipType
+	case "deb", "ar":
+		return debType
+	case "rpm":
+		return rpmType
+	default:
+		return byName
+	}
 
-			return d.writeFile(file, bs)
-		}
+	if byName == tarType || byName == plainType {
+		return byName
 	}
 
-	return errors.New("can't install released binary. This is a possibility that bug of `obt`. Please report an issue")
+	// writeStream finds out whether the decompressed content is a tarball.
+	return plainType
 }
 
-func (d *Downloader) downloadGzip(body *io.ReadCloser, file string) error {
-	r, err := gzip.NewReader(*body)
+func (d *Downloader) downloadTarGz(body *io.ReadCloser, file string) error {
+	archive, err := gzip.NewReader(*body)
 	if err != nil {
 		return err
 	}
 
-	bs, err := io.ReadAll(r)
+	return d.extractTar(d.guardExpanded(archive), file)
+}
+
+func (d *Downloader) downloadGzip(body *io.ReadCloser, file string) error {
+	r, err := gzip.NewReader(*body)
 	if err != nil {
 		return err
 	}
 
-	return d.writeFile(file, bs)
+	return d.writeStream(d.guardExpanded(r), file)
 }
 
 func (d *Downloader) downloadZip(body *io.ReadCloser, file string) error {
@@ -228,26 +431,27 @@ func (d *Downloader) downloadZip(body *io.ReadCloser, file string) error {
 		return err
 	}
 
+	var entries []*archiveEntry
 	for _, f := range z.File {
-		if filepath.Base(f.Name) == d.binaryName {
-			r, err := f.Open()
-			if err != nil {
-				return err
-			}
-
-			b, err := io.ReadAll(r)
-			if err != nil {
-				return err
-			}
-
-			return d.writeFile(file, b)
+		if err := d.countEntry(); err != nil {
+			return err
 		}
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		e, err := d.newLazyEntry(f.Name, f.Mode(), f.FileInfo().Size(), f.Open)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, e)
 	}
-	return errors.New("can't install released binary. This is a possibility that bug of `obt`. Please report an issue")
+
+	return d.installEntry(entries, file, d.matchEntry)
 }
 
 func (d *Downloader) downloadBinary(body *io.ReadCloser, file string) error {
-	bs, err := io.ReadAll(*body)
+	bs, err := d.readEntry(d.binaryName, *body, -1)
 	if err != nil {
 		return err
 	}
@@ -258,40 +462,89 @@ func (d *Downloader) downloadBinary(body *io.ReadCloser, file string) error {
 func (d *Downloader) downloadTarXz(body *io.ReadCloser, file string) error {
 	archive, err := xz.NewReader(*body)
 	if err != nil {
-		return nil
+		return err
 	}
 
-	tr := tar.NewReader(archive)
+	return d.extractTar(d.guardExpanded(archive), file)
+}
 
-	for {
-		hdr, err := tr.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil
-		}
+func (d *Downloader) downloadXz(body *io.ReadCloser, file string) error {
+	r, err := xz.NewReader(*body)
+	if err != nil {
+		return err
+	}
+
+	return d.writeStream(d.guardExpanded(r), file)
+}
 
-		if filepath.Base(hdr.Name) == d.binaryName {
-			bs, err := io.ReadAll(tr)
-			if err != nil {
-				return nil
-			}
+func (d *Downloader) downloadTarBz2(body *io.ReadCloser, file string) error {
+	return d.extractTar(d.guardExpanded(bzip2.NewReader(*body)), file)
+}
 
-			return d.writeFile(file, bs)
-		}
+func (d *Downloader) downloadBz2(body *io.ReadCloser, file string) error {
+	return d.writeStream(d.guardExpanded(bzip2.NewReader(*body)), file)
+}
+
+func (d *Downloader) downloadTarZst(body *io.ReadCloser, file string) error {
+	archive, err := zstd.NewReader(*body)
+	if err != nil {
+		return err
 	}
+	defer archive.Close()
 
-	return errors.New("can't install released binary. This is a possibility that bug of `obt`. Please report an issue")
+	return d.extractTar(d.guardExpanded(archive), file)
 }
 
-func (d *Downloader) downloadXz(body *io.ReadCloser, file string) error {
-	r, err := xz.NewReader(*body)
+func (d *Downloader) downloadZst(body *io.ReadCloser, file string) error {
+	r, err := zstd.NewReader(*body)
 	if err != nil {
 		return err
 	}
+	defer r.Close()
 
-	bs, err := io.ReadAll(r)
+	return d.writeStream(d.guardExpanded(r), file)
+}
+
+func (d *Downloader) download7z(body *io.ReadCloser, file string) error {
+	data, err := io.ReadAll(*body)
+	if err != nil {
+		return err
+	}
+
+	z, err := sevenzip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+
+	var entries []*archiveEntry
+	for _, f := range z.File {
+		if err := d.countEntry(); err != nil {
+			return err
+		}
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		e, err := d.newLazyEntry(f.Name, f.Mode(), f.FileInfo().Size(), f.Open)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, e)
+	}
+
+	return d.installEntry(entries, file, d.matchEntry)
+}
+
+// writeStream writes a decompressed stream. Some releases name a compressed
+// tarball like a plain compressed file, so the content is checked for a tar
+// header first.
+func (d *Downloader) writeStream(r io.Reader, file string) error {
+	br := bufio.NewReader(r)
+	if head, _ := br.Peek(262); isTar(head) {
+		return d.extractTar(br, file)
+	}
+
+	bs, err := d.readEntry(d.binaryName, br, -1)
 	if err != nil {
 		return err
 	}
@@ -299,8 +552,12 @@ func (d *Downloader) downloadXz(body *io.ReadCloser, file string) error {
 	return d.writeFile(file, bs)
 }
 
+func isTar(head []byte) bool {
+	return len(head) >= 262 && bytes.HasPrefix(head[257:], []byte("ustar"))
+}
+
 func (d *Downloader) isSupportedFormat(name string) bool {
-	suffixes := []string{"deb", "rpm", "msi", "apk"}
+	suffixes := []string{"msi", "apk"}
 	for _, v := range suffixes {
 		if strings.HasSuffix(name, v) {
 			return false
@@ -311,6 +568,13 @@ func (d *Downloader) isSupportedFormat(name string) bool {
 }
 
 func (d *Downloader) writeFile(file string, b []byte) error {
+	// Don't write through a link, e.g. to the AppRun of an extracted AppImage.
+	if fi, err := os.Lstat(file); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+	}
+
 	return os.WriteFile(file, b, 0755)
 }
 
@@ -325,11 +589,56 @@ func (d *Downloader) isBinary(file string) (bool, error) {
 	head := make([]byte, 261)
 	f.Read(head)
 
+	if bytes.HasPrefix(head, []byte("#!")) {
+		return d.acceptScript(head), nil
+	}
+
 	kind, err := filetype.Match(head)
 	if err != nil {
 		return false, err
 	}
 
-	res := kind.Extension == "elf"
-	return res, nil
+	// filetype reports both thin and universal Mach-O files as "macho", and
+	// PE files as "exe".
+	switch d.targetOS() {
+	case "darwin":
+		return kind.Extension == "macho", nil
+	case "windows":
+		return kind.Extension == "exe", nil
+	}
+
+	if kind.Extension != "elf" {
+		return false, nil
+	}
+
+	info, err := inspectELF(file, d.targetOS(), d.targetArch())
+	if err != nil {
+		return false, err
+	}
+	if isAppImage(file) {
+		info.format = "AppImage"
+	}
+
+	d.info = info
+	return true, nil
+}
+
+// acceptScript allows a script when the user opted in for the tool, or when
+// the asset has no platform markers and so is meant to run anywhere.
+func (d *Downloader) acceptScript(head []byte) bool {
+	if !d.allowScript && !d.portable {
+		return false
+	}
+
+	interpreter := string(head)
+	if i := strings.IndexByte(interpreter, '\n'); i >= 0 {
+		interpreter = interpreter[:i]
+	}
+	interpreter = strings.TrimSpace(interpreter)
+
+	d.info = &binaryInfo{format: "script", interpreter: interpreter}
+	if d.stderr != nil {
+		fmt.Fprintf(d.stderr, "warning: '%s' is a script, not a binary. It runs with '%s'.\n", d.binaryName, interpreter)
+	}
+	return true
 }
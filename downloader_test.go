@@ -1,12 +1,18 @@
 package main
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"testing"
 
+	"github.com/google/go-github/github"
 	"github.com/y-yagi/goext/osext"
 )
 
@@ -111,6 +117,41 @@ func TestDownloader_Zip(t *testing.T) {
 	}
 }
 
+func TestDownloader_ZipMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes aren't supported on Windows")
+	}
+
+	// zip.Writer.Create records no Unix mode, so the entry reports 0666.
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	w, err := zw.Create("tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("tool")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := io.NopCloser(bytes.NewReader(buf.Bytes()))
+	downloaded := filepath.Join(t.TempDir(), "tool")
+	d := Downloader{binaryName: "tool"}
+	if err := d.downloadZip(&r, downloaded); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(downloaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0755 {
+		t.Fatalf("expected mode 0755, but got %v", fi.Mode().Perm())
+	}
+}
+
 func TestDownloader_TarXz(t *testing.T) {
 	tempDir, err := os.MkdirTemp("", "obttest")
 	if err != nil {
@@ -152,7 +193,7 @@ func TestIsAvailableBinary(t *testing.T) {
 		want bool
 	}{
 		{"golangci-lint-1.23.8-" + osAndArch + ".tar.gz", true},
-		{"golangci-lint-1.23.8-" + osAndArch + ".deb", false},
+		{"golangci-lint-1.23.8-" + osAndArch + ".deb", runtime.GOOS == "linux"},
 		{"golangci-lint-1.23.8-" + osAndArch + ".gzip", true},
 		{"golangci-lint-1.23.8-" + osAndArch + ".zip", true},
 		{"golangci-lint-1.23.8-" + osAndArch + ".apk", false},
@@ -168,3 +209,680 @@ func TestIsAvailableBinary(t *testing.T) {
 	}
 
 }
+
+func TestRankAssets(t *testing.T) {
+	osAndArch := runtime.GOOS + "_" + runtime.GOARCH
+
+	names := []string{
+		"tool-1.0.0-" + osAndArch + ".tar.gz.sbom",
+		"tool-1.0.0-" + osAndArch + ".tar.gz.sha256",
+		"tool-1.0.0-" + osAndArch + "-debug.tar.gz",
+		"tool-1.0.0-" + osAndArch + "-gnu.tar.gz",
+		"tool-1.0.0-" + osAndArch + "-musl.tar.gz",
+		"tool-1.0.0-plan9_mips.tar.gz",
+	}
+
+	var assets []github.ReleaseAsset
+	for i := range names {
+		assets = append(assets, github.ReleaseAsset{Name: &names[i]})
+	}
+
+	d := Downloader{binaryName: "tool", libc: "gnu"}
+	candidates := d.rankAssets(assets)
+
+	want := []string{names[3], names[4], names[2]}
+	for i, name := range want {
+		if candidates[i].name != name || candidates[i].rejected {
+			t.Fatalf("rank %d: expected '%s', got '%s' (%v)", i, name, candidates[i].name, candidates[i].reasons)
+		}
+	}
+
+	for _, c := range candidates[len(want):] {
+		if !c.rejected {
+			t.Fatalf("expected '%s' to be rejected, got score %d", c.name, c.score)
+		}
+	}
+}
+
+func TestParsePlatform(t *testing.T) {
+	var tests = []struct {
+		in   string
+		want platform
+	}{
+		{"ripgrep-14.1.0-x86_64-unknown-linux-musl.tar.gz", platform{os: "linux", arch: "amd64", libc: "musl"}},
+		{"ripgrep-14.1.0-aarch64-unknown-linux-gnu.tar.gz", platform{os: "linux", arch: "arm64", libc: "gnu"}},
+		{"ripgrep-14.1.0-armv7-unknown-linux-gnueabihf.tar.gz", platform{os: "linux", arch: "arm", libc: "gnu"}},
+		{"ripgrep-14.1.0-i686-pc-windows-msvc.zip", platform{os: "windows", arch: "386"}},
+		{"fd-v10.1.0-aarch64-apple-darwin.tar.gz", platform{os: "darwin", arch: "arm64"}},
+		{"tool_1.0.0_Linux_x86_64.tar.gz", platform{os: "linux", arch: "amd64"}},
+		{"tool_1.0.0_macOS_arm64.tar.gz", platform{os: "darwin", arch: "arm64"}},
+		{"tool-linux-armhf", platform{os: "linux", arch: "arm"}},
+		{"tool-linux-arm64", platform{os: "linux", arch: "arm64"}},
+		{"tool-1.0.0-linux-musl-amd64", platform{os: "linux", arch: "amd64", libc: "musl"}},
+	}
+
+	for _, tt := range tests {
+		got := aliases.parse(tt.in)
+		if tt.want != got {
+			t.Fatalf("in: '%v', expected: %+v, got: %+v", tt.in, tt.want, got)
+		}
+	}
+}
+
+func TestAliasTableFromConfig(t *testing.T) {
+	table := newAliasTable(map[string][]string{"darwin": {"apple"}}, map[string][]string{"arm64": {"m1"}})
+
+	want := platform{os: "darwin", arch: "arm64"}
+	if got := table.parse("tool-apple-m1.zip"); got != want {
+		t.Fatalf("expected: %+v, got: %+v", want, got)
+	}
+
+	if got, ok := table.parseTargetTriple("aarch64-apple-darwin"); !ok || got != want {
+		t.Fatalf("expected: %+v, got: %+v", want, got)
+	}
+}
+
+func TestRankAssetsOnMuslSystem(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("libc variants are only used on Linux")
+	}
+
+	names := []string{
+		"tool-1.0.0-" + runtime.GOARCH + "-unknown-linux-gnu.tar.gz",
+		"tool-1.0.0-linux-" + runtime.GOARCH + ".tar.gz",
+		"tool-1.0.0-linux-" + runtime.GOARCH + "-static.tar.gz",
+		"tool-1.0.0-" + runtime.GOARCH + "-unknown-linux-musl.tar.gz",
+	}
+
+	var assets []github.ReleaseAsset
+	for i := range names {
+		assets = append(assets, github.ReleaseAsset{Name: &names[i]})
+	}
+
+	d := Downloader{binaryName: "tool", libc: "musl"}
+	candidates := d.rankAssets(assets)
+
+	want := []string{names[3], names[2], names[1]}
+	for i, name := range want {
+		if candidates[i].name != name || candidates[i].rejected {
+			t.Fatalf("rank %d: expected '%s', got '%s' (%v)", i, name, candidates[i].name, candidates[i].reasons)
+		}
+	}
+
+	if !candidates[3].rejected {
+		t.Fatalf("expected '%s' to be rejected on a musl system", candidates[3].name)
+	}
+}
+
+func TestIsBinaryForTarget(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "obttest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	executable, err := os.ReadFile(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headers := map[string][]byte{
+		"elf":       executable,
+		"macho":     {0xcf, 0xfa, 0xed, 0xfe},
+		"universal": {0xca, 0xfe, 0xba, 0xbe},
+		"pe":        []byte("MZ\x90\x00"),
+	}
+
+	var tests = []struct {
+		goos   string
+		header string
+		want   bool
+	}{
+		{runtime.GOOS, "elf", runtime.GOOS != "darwin" && runtime.GOOS != "windows"},
+		{"linux", "pe", false},
+		{"darwin", "macho", true},
+		{"darwin", "universal", true},
+		{"darwin", "elf", false},
+		{"windows", "pe", true},
+		{"windows", "macho", false},
+	}
+
+	for _, tt := range tests {
+		file := filepath.Join(tempDir, tt.header)
+		if err := os.WriteFile(file, append(headers[tt.header], make([]byte, 256)...), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		d := Downloader{goos: tt.goos}
+		got, err := d.isBinary(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.want != got {
+			t.Fatalf("goos: '%v', header: '%v', expected: %v, got: %v", tt.goos, tt.header, tt.want, got)
+		}
+	}
+}
+
+func TestExecutableName(t *testing.T) {
+	d := Downloader{binaryName: "tool", goos: "windows", goarch: "amd64"}
+	if got := d.executableName(); got != "tool.exe" {
+		t.Fatalf("expected 'tool.exe', got '%s'", got)
+	}
+
+	if !d.isAvailableBinary("tool-1.0.0-windows-x86_64.zip") {
+		t.Fatalf("expected windows asset to be available")
+	}
+
+	if d.isAvailableBinary("tool-1.0.0-linux-x86_64.tar.gz") {
+		t.Fatalf("expected linux asset not to be available")
+	}
+
+	if !d.isBinaryEntry("tool-1.0.0/tool.exe") {
+		t.Fatalf("expected 'tool.exe' to match the binary name")
+	}
+}
+
+func TestInspectELF(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the test binary is not an ELF file")
+	}
+
+	info, err := inspectELF(os.Args[0], runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.machine != runtime.GOARCH || info.static != (len(info.interpreter) == 0) {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+
+	otherArch := "arm64"
+	if runtime.GOARCH == "arm64" {
+		otherArch = "amd64"
+	}
+
+	_, err = inspectELF(os.Args[0], runtime.GOOS, otherArch)
+	if err == nil || !strings.Contains(err.Error(), "but the target is linux/"+otherArch) {
+		t.Fatalf("expected an architecture mismatch error, got %v", err)
+	}
+
+	_, err = inspectELF(os.Args[0], "freebsd", runtime.GOARCH)
+	if err == nil {
+		t.Fatalf("expected an OS ABI mismatch error")
+	}
+}
+
+func TestDownloader_CompressedFormats(t *testing.T) {
+	var tests = []struct {
+		fixture string
+		byName  fileType
+	}{
+		{"testdata/sample.tar.bz2", tarBz2Type},
+		{"testdata/sample.bz2", bz2Type},
+		{"testdata/sample.tar.zst", tarZstType},
+		{"testdata/sample.zst", zstType},
+		{"testdata/sample.7z", sevenZipType},
+		{"testdata/sample.deb", debType},
+		{"testdata/sample.rpm", rpmType},
+		// The type from the asset name is wrong, so the magic bytes are used.
+		{"testdata/sample.tar.zst", binary},
+		{"testdata/sample.tar.bz2", tarGzType},
+		{"testdata/sample.zst", gzipType},
+		{"testdata/sample.deb", binary},
+		{"testdata/sample.rpm", binary},
+	}
+
+	for _, tt := range tests {
+		tempDir, err := os.MkdirTemp("", "obttest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(tempDir)
+
+		buf, err := os.ReadFile(tt.fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := io.NopCloser(strings.NewReader(string(buf)))
+
+		downloaded := tempDir + "/sample"
+		binaryName := "sample.txt"
+		if strings.HasSuffix(tt.fixture, ".deb") || strings.HasSuffix(tt.fixture, ".rpm") {
+			binaryName = "sample"
+		}
+
+		d := Downloader{binaryName: binaryName, fType: tt.byName}
+		if err := d.download(&r, downloaded); err != nil {
+			t.Fatalf("%s: %v", tt.fixture, err)
+		}
+
+		buf, err = os.ReadFile(downloaded)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := "sample\n"
+		if string(buf) != want {
+			t.Fatalf("%s: expected '%s', but got '%s'\n", tt.fixture, want, buf)
+		}
+	}
+}
+
+func TestFileTypeFromName(t *testing.T) {
+	var tests = []struct {
+		in   string
+		want fileType
+	}{
+		{"tool-linux-amd64.tar.gz", tarGzType},
+		{"tool-linux-amd64.tar.bz2", tarBz2Type},
+		{"tool-linux-amd64.bz2", bz2Type},
+		{"tool-linux-amd64.tar.zst", tarZstType},
+		{"tool-linux-amd64.zst", zstType},
+		{"tool-linux-amd64.7z", sevenZipType},
+		{"tool_1.0.0_amd64.deb", debType},
+		{"tool-1.0.0-1.x86_64.rpm", rpmType},
+		{"tool-linux-amd64", binary},
+	}
+
+	for _, tt := range tests {
+		if got := fileTypeFromName(tt.in); tt.want != got {
+			t.Fatalf("in: '%v', expected: %v, got: %v", tt.in, tt.want, got)
+		}
+	}
+}
+
+func TestAppImage(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("AppImages are Linux only")
+	}
+
+	tempDir, err := os.MkdirTemp("", "obttest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	executable, err := os.ReadFile(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(executable[8:], appImageMagic)
+
+	file := filepath.Join(tempDir, "tool")
+	if err := os.WriteFile(file, executable, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	d := Downloader{binaryName: "tool"}
+	if ok, err := d.isBinary(file); !ok || err != nil {
+		t.Fatalf("expected an AppImage to be installable, got %v, %v", ok, err)
+	}
+	if d.info.format != "AppImage" {
+		t.Fatalf("expected format 'AppImage', got '%s'", d.info.format)
+	}
+
+	arch := map[string]string{"amd64": "x86_64", "arm64": "aarch64", "386": "i386", "arm": "armhf"}[runtime.GOARCH]
+	if !d.isAvailableBinary("Tool-1.0.0-" + arch + ".AppImage") {
+		t.Fatalf("expected an AppImage for %s to be available", arch)
+	}
+	if d.isAvailableBinary("Tool-1.0.0-" + arch + ".AppImage.zsync") {
+		t.Fatalf("expected a zsync file not to be available")
+	}
+}
+
+func TestExtractAppImagePayload(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("AppImages are Linux only")
+	}
+
+	tempDir, err := os.MkdirTemp("", "obttest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// A stand-in for the AppImage runtime's "--appimage-extract".
+	file := filepath.Join(tempDir, "tool")
+	script := "#!/bin/sh\nmkdir -p squashfs-root && printf '#!/bin/sh\\necho apprun\\n' > squashfs-root/AppRun && chmod +x squashfs-root/AppRun\n"
+	if err := os.WriteFile(file, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	d := Downloader{binaryName: "tool", dataPath: filepath.Join(tempDir, "data")}
+	if err := d.extractAppImagePayload(file); err != nil {
+		t.Fatal(err)
+	}
+
+	link, err := os.Readlink(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := filepath.Join(tempDir, "data", "appimages", "tool", "AppRun")
+	if link != want {
+		t.Fatalf("expected '%s', got '%s'", want, link)
+	}
+
+	if err := d.writeFile(file, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(want); !strings.Contains(string(b), "apprun") {
+		t.Fatalf("expected AppRun not to be overwritten, got '%s'", b)
+	}
+}
+
+func TestScriptRelease(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "obttest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	file := filepath.Join(tempDir, "tool")
+	if err := os.WriteFile(file, []byte("#!/usr/bin/env python3\nprint('tool')\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	d := Downloader{binaryName: "tool"}
+	if ok, _ := d.isBinary(file); ok {
+		t.Fatalf("expected a script to be refused without opting in")
+	}
+
+	stderr := new(strings.Builder)
+	d = Downloader{binaryName: "tool", allowScript: true, stderr: stderr}
+	if ok, err := d.isBinary(file); !ok || err != nil {
+		t.Fatalf("expected a script to be accepted, got %v, %v", ok, err)
+	}
+	if !strings.Contains(stderr.String(), "#!/usr/bin/env python3") {
+		t.Fatalf("expected a warning with the interpreter, got '%s'", stderr.String())
+	}
+
+	c := d.scoreAsset("tool")
+	if c.rejected || !c.portable {
+		t.Fatalf("expected an asset without platform markers to be portable, got %v", c.reasons)
+	}
+	if c := d.scoreAsset("README"); !c.rejected {
+		t.Fatalf("expected an unrelated asset to be rejected")
+	}
+}
+
+type tarEntry struct {
+	name     string
+	typeflag byte
+	linkname string
+	mode     int64
+	body     string
+}
+
+func buildTar(t *testing.T, entries []tarEntry) io.ReadCloser {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Typeflag: e.typeflag, Linkname: e.linkname, Mode: e.mode, Size: int64(len(e.body))}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return io.NopCloser(&buf)
+}
+
+func TestDownloader_TarLinks(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "obttest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	var tests = []struct {
+		name          string
+		pathInArchive string
+		entries       []tarEntry
+		want          string
+		wantMode      os.FileMode
+		wantErr       string
+	}{
+		{
+			name: "symlink",
+			entries: []tarEntry{
+				{name: "tool/bin/tool-1.2.3", typeflag: tar.TypeReg, mode: 0750, body: "binary"},
+				{name: "tool/tool", typeflag: tar.TypeSymlink, linkname: "bin/tool-1.2.3", mode: 0777},
+			},
+			want:     "binary",
+			wantMode: 0750,
+		},
+		{
+			name: "hardlink",
+			entries: []tarEntry{
+				{name: "tool/bin/tool-1.2.3", typeflag: tar.TypeReg, mode: 0755, body: "binary"},
+				{name: "tool/tool", typeflag: tar.TypeLink, linkname: "tool/bin/tool-1.2.3", mode: 0755},
+			},
+			want:     "binary",
+			wantMode: 0755,
+		},
+		{
+			name: "symlink and target with the same name",
+			entries: []tarEntry{
+				{name: "tool/bin/tool", typeflag: tar.TypeReg, mode: 0755, body: "binary"},
+				{name: "tool/tool", typeflag: tar.TypeSymlink, linkname: "bin/tool", mode: 0777},
+			},
+			want:     "binary",
+			wantMode: 0755,
+		},
+		{
+			name: "ambiguous",
+			entries: []tarEntry{
+				{name: "tool/linux/tool", typeflag: tar.TypeReg, mode: 0755, body: "linux"},
+				{name: "tool/musl/tool", typeflag: tar.TypeReg, mode: 0755, body: "musl"},
+			},
+			wantErr: "tool/linux/tool\n  tool/musl/tool",
+		},
+		{
+			name:          "path in archive",
+			pathInArchive: "tool/musl/*",
+			entries: []tarEntry{
+				{name: "tool/linux/tool", typeflag: tar.TypeReg, mode: 0755, body: "linux"},
+				{name: "tool/musl/tool", typeflag: tar.TypeReg, mode: 0700, body: "musl"},
+			},
+			want:     "musl",
+			wantMode: 0700,
+		},
+		{
+			name: "dangling symlink",
+			entries: []tarEntry{
+				{name: "tool/tool", typeflag: tar.TypeSymlink, linkname: "bin/tool-1.2.3", mode: 0777},
+			},
+			wantErr: "isn't in the archive",
+		},
+	}
+
+	for _, tt := range tests {
+		downloaded := filepath.Join(tempDir, "tool")
+		os.Remove(downloaded)
+
+		d := Downloader{binaryName: "tool", pathInArchive: tt.pathInArchive}
+		err := d.extractTar(buildTar(t, tt.entries), downloaded)
+		if len(tt.wantErr) != 0 {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("%s: expected error with '%s', got %v", tt.name, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		buf, err := os.ReadFile(downloaded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != tt.want {
+			t.Fatalf("%s: expected '%s', but got '%s'", tt.name, tt.want, buf)
+		}
+
+		fi, err := os.Stat(downloaded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != tt.wantMode {
+			t.Fatalf("%s: expected mode %v, but got %v", tt.name, tt.wantMode, fi.Mode().Perm())
+		}
+	}
+}
+
+type cpioEntry struct {
+	name  string
+	inode int
+	mode  int
+	nlink int
+	body  string
+}
+
+func buildCpio(entries []cpioEntry) io.Reader {
+	var buf bytes.Buffer
+	pad := func() {
+		for buf.Len()%4 != 0 {
+			buf.WriteByte(0)
+		}
+	}
+	write := func(e cpioEntry) {
+		nlink := e.nlink
+		if nlink == 0 {
+			nlink = 1
+		}
+		fmt.Fprintf(&buf, "070701%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X", e.inode, e.mode, 0, 0, nlink, 0, len(e.body), 0, 0, 0, 0, len(e.name)+1, 0)
+		buf.WriteString(e.name + "\x00")
+		pad()
+		buf.WriteString(e.body)
+		pad()
+	}
+
+	for _, e := range entries {
+		write(e)
+	}
+	write(cpioEntry{name: cpioTrailer})
+	return &buf
+}
+
+func TestExtractCpio(t *testing.T) {
+	tempDir := t.TempDir()
+
+	var tests = []struct {
+		name     string
+		entries  []cpioEntry
+		want     string
+		wantMode os.FileMode
+		wantErr  string
+	}{
+		{
+			name: "mode",
+			entries: []cpioEntry{
+				{name: "./usr/bin/tool", inode: 1, mode: 0100750, body: "binary"},
+			},
+			want:     "binary",
+			wantMode: 0750,
+		},
+		{
+			name: "symlink",
+			entries: []cpioEntry{
+				{name: "./usr/libexec/tool/tool-1.2.3", inode: 1, mode: 0100755, body: "binary"},
+				{name: "./usr/bin/tool", inode: 2, mode: 0120777, body: "../libexec/tool/tool-1.2.3"},
+			},
+			want:     "binary",
+			wantMode: 0755,
+		},
+		{
+			name: "hardlink",
+			entries: []cpioEntry{
+				{name: "./usr/bin/tool", inode: 1, mode: 0100755, nlink: 2},
+				{name: "./usr/libexec/tool", inode: 1, mode: 0100755, nlink: 2, body: "binary"},
+			},
+			want:     "binary",
+			wantMode: 0755,
+		},
+		{
+			name: "ambiguous",
+			entries: []cpioEntry{
+				{name: "./usr/bin/tool", inode: 1, mode: 0100755, body: "usr"},
+				{name: "./bin/tool", inode: 2, mode: 0100755, body: "bin"},
+			},
+			wantErr: "several entries",
+		},
+	}
+
+	for _, tt := range tests {
+		downloaded := filepath.Join(tempDir, "tool")
+		os.Remove(downloaded)
+
+		d := Downloader{binaryName: "tool"}
+		err := d.extractCpio(buildCpio(tt.entries), downloaded, d.isPackagedBinary)
+		if len(tt.wantErr) != 0 {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("%s: expected error with '%s', got %v", tt.name, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		fi, err := os.Stat(downloaded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf, _ := os.ReadFile(downloaded); string(buf) != tt.want || fi.Mode().Perm() != tt.wantMode {
+			t.Fatalf("%s: expected '%s' with %v, but got '%s' with %v", tt.name, tt.want, tt.wantMode, buf, fi.Mode().Perm())
+		}
+	}
+}
+
+func TestOutputName(t *testing.T) {
+	tests := []struct {
+		binaryName string
+		outputName string
+		goos       string
+		want       string
+	}{
+		{"kubectl", "", "linux", "kubectl"},
+		{"kubectl", "kubectl-1.29", "linux", "kubectl-1.29"},
+		{"bat", "batcat", "windows", "batcat.exe"},
+		{"bat", "batcat.exe", "windows", "batcat.exe"},
+	}
+
+	for _, tt := range tests {
+		d := Downloader{binaryName: tt.binaryName, outputName: tt.outputName, goos: tt.goos}
+		if got := d.installName(); got != tt.want {
+			t.Fatalf("binaryName: '%v', outputName: '%v', expected '%v', got '%v'", tt.binaryName, tt.outputName, tt.want, got)
+		}
+	}
+
+	tempDir := t.TempDir()
+	r := buildTar(t, []tarEntry{{name: "bat-1.0/bat", typeflag: tar.TypeReg, mode: 0755, body: "bat\n"}})
+	d := Downloader{binaryName: "bat", outputName: "batcat"}
+	file := filepath.Join(tempDir, d.installName())
+	if err := d.extractTar(r, file); err != nil {
+		t.Fatal(err)
+	}
+	if !osext.IsExist(file) {
+		t.Fatalf("'%s' isn't installed", file)
+	}
+
+	hf := HistoryFile{filename: filepath.Join(tempDir, "history")}
+	if err := hf.save(d, "https://github.com/sharkdp/bat", file, "", d.binaryName); err != nil {
+		t.Fatal(err)
+	}
+	histories, err := hf.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := histories[file]
+	if h == nil || h.BinaryName != "bat" || h.OutputName != "batcat" {
+		t.Fatalf("unexpected history %+v", h)
+	}
+}
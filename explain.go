@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/olekukonko/tablewriter/tw"
+)
+
+func explain(stdout io.Writer) error {
+	if len(flags.Args()) == 0 {
+		flags.Usage()
+		return nil
+	}
+
+	_, user, repository, ok := parseRepositoryURL(flags.Args()[0])
+	if !ok {
+		flags.Usage()
+		return nil
+	}
+
+	d, err := newDownloader(user, repository)
+	if err != nil {
+		return err
+	}
+
+	release, err := d.fetchRelease()
+	if err != nil {
+		return err
+	}
+
+	d.resolveTarget()
+	d.inferBinaryName(release.Assets)
+	candidates := d.rankAssets(release.Assets)
+
+	fmt.Fprintf(stdout, "Release '%s' of '%s/%s' (binary name: '%s', target: %s/%s, libc: '%s')\n", d.releaseTag, d.user, d.repository, d.binaryName, d.goos, d.goarch, d.libc)
+	return renderCandidates(stdout, candidates)
+}
+
+func renderCandidates(stdout io.Writer, candidates []*assetCandidate) error {
+	table := tablewriter.NewTable(stdout, tablewriter.WithSymbols(tw.NewSymbols(tw.StyleASCII)))
+	table.Header("ASSET", "SCORE", "RESULT", "REASON")
+
+	for i, c := range candidates {
+		result := "lost"
+		score := strconv.Itoa(c.score)
+		switch {
+		case c.rejected:
+			result = "rejected"
+			score = "-"
+		case i == 0:
+			result = "selected"
+		}
+
+		err := table.Append([]string{c.name, score, result, strings.Join(c.reasons, ", ")})
+		if err != nil {
+			return err
+		}
+	}
+
+	return table.Render()
+}
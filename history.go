@@ -1,12 +1,47 @@
 package main
 
+import (
+	"io/fs"
+	"time"
+)
+
 type History struct {
-	URL        string
-	Tag        string
-	Path       string
-	BinaryName string
+	URL           string      `json:"url"`
+	Tag           string      `json:"tag"`
+	PreviousTag   string      `json:"previous_tag,omitempty"`
+	Path          string      `json:"path"`
+	Target        string      `json:"target,omitempty"`
+	BinaryName    string      `json:"binary_name"`
+	OutputName    string      `json:"output_name,omitempty"`
+	OS            string      `json:"os,omitempty"`
+	Arch          string      `json:"arch,omitempty"`
+	Libc          string      `json:"libc,omitempty"`
+	AppImage      bool        `json:"appimage,omitempty"`
+	AllowScript   bool        `json:"allow_script,omitempty"`
+	PathInArchive string      `json:"path_in_archive,omitempty"`
+	Host          string      `json:"host,omitempty"`
+	AssetName     string      `json:"asset_name,omitempty"`
+	AssetURL      string      `json:"asset_url,omitempty"`
+	AssetSize     int64       `json:"asset_size,omitempty"`
+	FileType      string      `json:"file_type,omitempty"`
+	SHA256        string      `json:"sha256,omitempty"`
+	Size          int64       `json:"size,omitempty"`
+	Mode          fs.FileMode `json:"mode,omitempty"`
+	InstalledAt   time.Time   `json:"installed_at,omitzero"`
+	UpdatedAt     time.Time   `json:"updated_at,omitzero"`
 }
 
+// key identifies a history. Versioned installs share the link path, so each
+// version is kept by its target.
 func (h *History) key() string {
+	return h.installedFile()
+}
+
+// installedFile returns the file obt wrote, which is the target of the link
+// for versioned installs.
+func (h *History) installedFile() string {
+	if len(h.Target) != 0 {
+		return h.Target
+	}
 	return h.Path
 }
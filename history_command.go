@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+func historyCommand(stdout io.Writer, args []string) error {
+	if len(args) == 0 {
+		return errors.New("please specify a command. Usage: obt history export [FILE] | import FILE | repair | prune | scan [DIR...]")
+	}
+
+	hf := HistoryFile{filename: determineHistoryFilePath()}
+	switch args[0] {
+	case "export":
+		return exportHistories(stdout, hf, args[1:])
+	case "import":
+		return importHistories(stdout, hf, args[1:])
+	case "prune":
+		return pruneHistories(stdout, hf, func() bool { return askForConfirmation(stdout) })
+	case "repair":
+		return repairHistory(stdout, hf, historyBinDirs(), determineDataPath())
+	case "scan":
+		dirs := args[1:]
+		if len(dirs) == 0 {
+			dirs = historyBinDirs()
+		}
+		return scanReceipts(stdout, hf, dirs)
+	}
+
+	return fmt.Errorf("unknown history command '%s'", args[0])
+}
+
+// historyBinDirs returns the install path in use and "bin_dirs" in the config.
+func historyBinDirs() []string {
+	dirs := receiptDirs()
+	if binDir, err := determinePath(); err == nil && binDir != cfg.Path {
+		dirs = append([]string{binDir}, dirs...)
+	}
+	return dirs
+}
+
+// scanReceipts merges the receipts in dirs into the history.
+func scanReceipts(stdout io.Writer, hf HistoryFile, dirs []string) error {
+	if len(dirs) == 0 {
+		return errors.New("please specify a directory. Usage: obt history scan [DIR...]")
+	}
+
+	merged := 0
+	err := hf.update(func(histories map[string]*History) error {
+		merged = mergeReceipts(histories, dirs)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Merge %d receipts from '%s'.\n", merged, strings.Join(dirs, "', '"))
+	return nil
+}
+
+// exportHistories writes the history as JSON to a file, or stdout without one.
+func exportHistories(stdout io.Writer, hf HistoryFile, args []string) error {
+	histories, err := hf.load()
+	if err != nil {
+		return err
+	}
+
+	b, err := encodeHistories(histories)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		_, err = stdout.Write(b)
+		return err
+	}
+
+	if err := os.WriteFile(args[0], b, 0600); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Export %d histories to '%s'.\n", len(histories), args[0])
+	return nil
+}
+
+// importHistories merges an exported file, or a gob file of older versions,
+// into the history. Imported entries replace the ones with the same path.
+func importHistories(stdout io.Writer, hf HistoryFile, args []string) error {
+	if len(args) != 1 {
+		return errors.New("please specify a file. Usage: obt history import FILE")
+	}
+
+	b, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	imported, _, err := decodeHistoryFile(b)
+	if err != nil {
+		return err
+	}
+
+	err = hf.update(func(histories map[string]*History) error {
+		for _, h := range imported {
+			histories[h.key()] = h
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Import %d histories from '%s'.\n", len(imported), args[0])
+	return nil
+}
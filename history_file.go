@@ -2,59 +2,318 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/y-yagi/goext/osext"
 )
 
+// historyVersion is the schema version of the history file. Increase it when
+// a change can't be read by older versions of obt.
+const historyVersion = 1
+
+// maxHistoryBackups is the number of backups kept next to the history file,
+// "history.bak.1" being the newest.
+const maxHistoryBackups = 3
+
+var errNewerHistory = errors.New("history file is written by a newer version of obt. Please update obt")
+
 type HistoryFile struct {
 	filename string
 }
 
+type historyDocument struct {
+	Version   int                 `json:"version"`
+	Histories map[string]*History `json:"histories"`
+}
+
 func (hf *HistoryFile) load() (map[string]*History, error) {
 	if !osext.IsExist(hf.filename) {
 		return nil, errors.New("history file doesn't exist")
 	}
 
-	b, err := os.ReadFile(hf.filename)
+	histories, legacy, err := hf.read()
 	if err != nil {
 		return nil, err
 	}
 
-	var histories map[string]*History
+	if legacy {
+		// Convert it once. update reads the file again under the lock.
+		if err := hf.update(func(map[string]*History) error { return nil }); err != nil {
+			return nil, err
+		}
+	}
+
+	return histories, nil
+}
 
-	buf := bytes.NewBuffer(b)
-	err = gob.NewDecoder(buf).Decode(&histories)
+// read reads the history file without a lock. legacy is true for gob files
+// written by older versions of obt.
+func (hf *HistoryFile) read() (histories map[string]*History, legacy bool, err error) {
+	b, err := os.ReadFile(hf.filename)
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+	return hf.decode(b)
+}
+
+func (hf *HistoryFile) decode(b []byte) (histories map[string]*History, legacy bool, err error) {
+	histories, legacy, err = decodeHistoryFile(b)
+	if errors.Is(err, errNewerHistory) {
+		return nil, false, err
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("history file '%s' is broken (%v). Please run 'obt history repair'", hf.filename, err)
 	}
+	return histories, legacy, nil
+}
 
-	return histories, nil
+func decodeHistoryFile(b []byte) (histories map[string]*History, legacy bool, err error) {
+	if isJSONHistory(b) {
+		histories, err = decodeHistories(b)
+		return histories, false, err
+	}
+
+	histories, err = decodeGobHistories(b)
+	return histories, true, err
 }
 
-func (hf *HistoryFile) save(d Downloader, url, downloadedFile, binaryName string) error {
-	var histories map[string]*History
-	var buf *bytes.Buffer
-	var err error
+func (hf *HistoryFile) backupName(i int) string {
+	return fmt.Sprintf("%s.bak.%d", hf.filename, i)
+}
+
+// rotateBackups writes prev, the content of the history file before it was
+// replaced, to the newest backup and drops the oldest one.
+func (hf *HistoryFile) rotateBackups(prev []byte) error {
+	for i := maxHistoryBackups - 1; i > 0; i-- {
+		if osext.IsExist(hf.backupName(i)) {
+			if err := os.Rename(hf.backupName(i), hf.backupName(i+1)); err != nil {
+				return err
+			}
+		}
+	}
+	return os.WriteFile(hf.backupName(1), prev, 0600)
+}
+
+// lock takes the lock of the history file. Other obt processes wait for it,
+// so changes aren't lost when they run at once.
+func (hf *HistoryFile) lock() (unlock func(), err error) {
+	f, err := os.OpenFile(hf.filename+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
 
+// update runs fn with the histories and writes the result under the lock.
+// Backups are rotated only after the new file is written.
+func (hf *HistoryFile) update(fn func(histories map[string]*History) error) error {
+	unlock, err := hf.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	histories := map[string]*History{}
+	var prev []byte
+	legacy := false
 	if osext.IsExist(hf.filename) {
-		histories, err = hf.load()
-		if err != nil {
+		if prev, err = os.ReadFile(hf.filename); err != nil {
+			return err
+		}
+		if histories, legacy, err = hf.decode(prev); err != nil {
 			return err
 		}
-	} else {
-		histories = map[string]*History{}
+
+		// Keep the gob file of older versions as a backup.
+		if legacy {
+			if err := copyFile(hf.filename, hf.filename+".gob.bak"); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := fn(histories); err != nil {
+		return err
+	}
+
+	b, err := encodeHistories(histories)
+	if err != nil {
+		return err
+	}
+	if prev != nil && bytes.Equal(b, prev) {
+		return nil
+	}
+	if err := hf.writeData(b); err != nil {
+		return err
+	}
+
+	// A converted gob file is kept as "history.gob.bak" instead.
+	if prev == nil || legacy {
+		return nil
+	}
+	return hf.rotateBackups(prev)
+}
+
+func (hf *HistoryFile) save(d Downloader, url, downloadedFile, target, binaryName string) error {
+	h := newHistory(d, url, downloadedFile, target, binaryName)
+	err := hf.update(func(histories map[string]*History) error {
+		putHistory(histories, h)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return writeReceipt(h)
+}
+
+// newHistory records an install by d. The checksum is of the installed file.
+func newHistory(d Downloader, url, downloadedFile, target, binaryName string) *History {
+	h := History{URL: url, Tag: d.releaseTag, Path: downloadedFile, Target: target, BinaryName: binaryName, OutputName: d.outputName, OS: d.goos, Arch: d.goarch, Libc: d.libc, AppImage: d.appImage, AllowScript: d.allowScript, PathInArchive: d.pathInArchive}
+	h.Host = hostOf(url)
+	h.AssetName = d.assetName
+	h.AssetURL = d.url
+	h.AssetSize = d.assetSize
+	h.FileType = d.fType.String()
+	h.SHA256, _ = sha256File(h.installedFile())
+	if fi, err := os.Stat(h.installedFile()); err == nil {
+		h.Size = fi.Size()
+		h.Mode = fi.Mode().Perm()
+	}
+	h.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	h.InstalledAt = h.UpdatedAt
+	return &h
+}
+
+// putHistory adds h, keeping the install time of the entry it replaces.
+func putHistory(histories map[string]*History, h *History) {
+	if prev, ok := histories[h.key()]; ok {
+		if !prev.InstalledAt.IsZero() {
+			h.InstalledAt = prev.InstalledAt
+		}
+		h.PreviousTag = prev.PreviousTag
+		if prev.Tag != h.Tag {
+			h.PreviousTag = prev.Tag
+		}
+	}
+	histories[h.key()] = h
+}
+
+// write replaces the history file atomically, so a reader never sees a
+// partially written file.
+func (hf *HistoryFile) write(histories map[string]*History) error {
+	b, err := encodeHistories(histories)
+	if err != nil {
+		return err
+	}
+	return hf.writeData(b)
+}
+
+func (hf *HistoryFile) writeData(b []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(hf.filename), filepath.Base(hf.filename)+".*.tmp")
+	if err != nil {
+		return err
 	}
+	defer os.Remove(f.Name())
 
-	h := History{URL: url, Tag: d.releaseTag, Path: downloadedFile, BinaryName: binaryName}
-	histories[h.key()] = &h
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0600); err != nil {
+		return err
+	}
 
-	buf = bytes.NewBuffer(nil)
-	if err := gob.NewEncoder(buf).Encode(histories); err != nil {
+	return os.Rename(f.Name(), hf.filename)
+}
+
+func copyFile(src, dst string) error {
+	b, err := os.ReadFile(src)
+	if err != nil {
 		return err
 	}
+	return os.WriteFile(dst, b, 0600)
+}
+
+func sha256File(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hostOf returns the host of the repository URL, e.g. "github.com".
+func hostOf(repositoryURL string) string {
+	u, err := url.Parse(repositoryURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+func isJSONHistory(b []byte) bool {
+	b = bytes.TrimSpace(b)
+	return len(b) > 0 && b[0] == '{'
+}
+
+func encodeHistories(histories map[string]*History) ([]byte, error) {
+	b, err := json.MarshalIndent(historyDocument{Version: historyVersion, Histories: histories}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+func decodeHistories(b []byte) (map[string]*History, error) {
+	var doc historyDocument
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+
+	if doc.Version > historyVersion {
+		return nil, fmt.Errorf("%w: version %d", errNewerHistory, doc.Version)
+	}
 
-	return os.WriteFile(hf.filename, buf.Bytes(), 0600)
+	if doc.Histories == nil {
+		doc.Histories = map[string]*History{}
+	}
+	return doc.Histories, nil
+}
+
+func decodeGobHistories(b []byte) (map[string]*History, error) {
+	var histories map[string]*History
+	if err := gob.NewDecoder(bytes.NewBuffer(b)).Decode(&histories); err != nil {
+		return nil, err
+	}
+	return histories, nil
 }
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/y-yagi/goext/osext"
+)
+
+func TestHistoryFileMigration(t *testing.T) {
+	tempDir := t.TempDir()
+	b, err := os.ReadFile("testdata/history")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hf := HistoryFile{filename: filepath.Join(tempDir, "history")}
+	if err := os.WriteFile(hf.filename, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	histories, err := hf.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := histories["/home/y-yagi/gobin/jpcal"]
+	if h == nil || h.URL != "https://github.com/y-yagi/jpcal" || h.Tag != "v1.0.2" {
+		t.Fatalf("unexpected history %+v", h)
+	}
+
+	backup, err := os.ReadFile(hf.filename + ".gob.bak")
+	if err != nil || !bytes.Equal(backup, b) {
+		t.Fatalf("expected the gob file to be kept as a backup: %v", err)
+	}
+
+	migrated, err := os.ReadFile(hf.filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(migrated), "{\n  \"version\": 1,") || !strings.Contains(string(migrated), `"tag": "v1.0.2"`) {
+		t.Fatalf("unexpected history file:\n%s", migrated)
+	}
+
+	again, err := hf.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != 1 || *again["/home/y-yagi/gobin/jpcal"] != *h {
+		t.Fatalf("expected the same histories after migration, got %+v", again)
+	}
+
+	if err := os.WriteFile(hf.filename, []byte(`{"version": 2, "histories": {}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hf.load(); err == nil || !strings.Contains(err.Error(), "version 2") {
+		t.Fatalf("expected an error for a newer version, got %v", err)
+	}
+}
+
+func TestHistoryExportImport(t *testing.T) {
+	tempDir := t.TempDir()
+	src := HistoryFile{filename: filepath.Join(tempDir, "src")}
+	dst := HistoryFile{filename: filepath.Join(tempDir, "dst")}
+
+	d := Downloader{releaseTag: "v1.0.0"}
+	if err := src.save(d, "https://github.com/owner/tool", "/usr/local/bin/tool", "", "tool"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.save(d, "https://github.com/owner/other", "/usr/local/bin/other", "", "other"); err != nil {
+		t.Fatal(err)
+	}
+
+	exported := filepath.Join(tempDir, "export.json")
+	stdout := new(bytes.Buffer)
+	if err := exportHistories(stdout, src, []string{exported}); err != nil {
+		t.Fatal(err)
+	}
+	if err := importHistories(stdout, dst, []string{exported}); err != nil {
+		t.Fatal(err)
+	}
+
+	histories, err := dst.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(histories) != 2 || histories["/usr/local/bin/tool"] == nil || histories["/usr/local/bin/other"] == nil {
+		t.Fatalf("unexpected histories %+v", histories)
+	}
+
+	// The gob file of older versions can be imported as well.
+	if err := importHistories(stdout, dst, []string{"testdata/history"}); err != nil {
+		t.Fatal(err)
+	}
+	histories, _ = dst.load()
+	if len(histories) != 3 {
+		t.Fatalf("expected 3 histories, got %d", len(histories))
+	}
+}
+
+func TestHistoryFileMetadata(t *testing.T) {
+	tempDir := t.TempDir()
+	hf := HistoryFile{filename: filepath.Join(tempDir, "history")}
+	file := filepath.Join(tempDir, "tool")
+	url := "https://github.com/owner/tool"
+
+	if err := os.WriteFile(file, []byte("v1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	d := Downloader{releaseTag: "v1.0.0", goos: "linux", goarch: "amd64", libc: "musl", assetName: "tool-linux-amd64-musl.tar.gz", url: "https://example.com/tool.tar.gz", assetSize: 2048, fType: tarGzType}
+	if err := hf.save(d, url, file, "", "tool"); err != nil {
+		t.Fatal(err)
+	}
+
+	histories, err := hf.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := *histories[file]
+	want := History{URL: url, Tag: "v1.0.0", Path: file, BinaryName: "tool", OS: "linux", Arch: "amd64", Libc: "musl", Host: "github.com", AssetName: "tool-linux-amd64-musl.tar.gz", AssetURL: "https://example.com/tool.tar.gz", AssetSize: 2048, FileType: "tar.gz",
+		SHA256: "3bfc269594ef649228e9a74bab00f042efc91d5acc6fbee31a382e80d42388fe", Size: 2, Mode: first.Mode, InstalledAt: first.InstalledAt, UpdatedAt: first.UpdatedAt}
+	if first != want || first.InstalledAt.IsZero() || first.Mode == 0 {
+		t.Fatalf("expected %+v, got %+v", want, first)
+	}
+
+	if err := os.WriteFile(file, []byte("v2"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	d.releaseTag = "v2.0.0"
+	if err := hf.save(d, url, file, "", "tool"); err != nil {
+		t.Fatal(err)
+	}
+
+	histories, _ = hf.load()
+	second := histories[file]
+	if second.PreviousTag != "v1.0.0" || !second.InstalledAt.Equal(first.InstalledAt) || second.SHA256 == first.SHA256 {
+		t.Fatalf("unexpected history after an update %+v", second)
+	}
+}
+
+func TestHistoryFileConcurrentSave(t *testing.T) {
+	tempDir := t.TempDir()
+	hf := HistoryFile{filename: filepath.Join(tempDir, "history")}
+
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			other := HistoryFile{filename: hf.filename}
+			file := filepath.Join(tempDir, fmt.Sprintf("tool%d", i))
+			if err := other.save(Downloader{releaseTag: "v1.0.0"}, "https://github.com/owner/tool", file, "", "tool"); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	histories, err := hf.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(histories) != n {
+		t.Fatalf("expected %d histories, got %d", n, len(histories))
+	}
+
+	tmp, _ := filepath.Glob(hf.filename + ".*.tmp")
+	if len(tmp) != 0 {
+		t.Fatalf("temporary files are left: %v", tmp)
+	}
+}
+
+func TestHistoryFileRepair(t *testing.T) {
+	tempDir := t.TempDir()
+	hf := HistoryFile{filename: filepath.Join(tempDir, "history")}
+
+	for i := 0; i < 5; i++ {
+		file := filepath.Join(tempDir, fmt.Sprintf("tool%d", i))
+		if err := hf.save(Downloader{releaseTag: "v1.0.0"}, "https://github.com/owner/tool", file, "", "tool"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if osext.IsExist(hf.backupName(maxHistoryBackups + 1)) {
+		t.Fatalf("expected only %d backups", maxHistoryBackups)
+	}
+
+	// Failed and unchanged updates don't rotate the backups.
+	backup, _ := os.ReadFile(hf.backupName(1))
+	if err := hf.update(func(map[string]*History) error { return errors.New("failed") }); err == nil {
+		t.Fatal("expected the error of fn")
+	}
+	if err := hf.update(func(map[string]*History) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(hf.backupName(1)); !bytes.Equal(b, backup) {
+		t.Fatalf("expected the backups to be kept")
+	}
+
+	b, err := os.ReadFile(hf.filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(hf.filename, b[:len(b)/2], 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hf.load(); err == nil || !strings.Contains(err.Error(), "obt history repair") {
+		t.Fatalf("expected an error to suggest repair, got %v", err)
+	}
+
+	stdout := new(bytes.Buffer)
+	if err := repairHistory(stdout, hf, []string{tempDir}, tempDir); err != nil {
+		t.Fatal(err)
+	}
+	histories, err := hf.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(histories) != 4 || !strings.Contains(stdout.String(), "history.bak.1") {
+		t.Fatalf("expected 4 histories restored from the newest backup, got %d: %s", len(histories), stdout)
+	}
+
+	// Without backups, versioned installs are found in the data directory.
+	for i := 1; i <= maxHistoryBackups; i++ {
+		os.Remove(hf.backupName(i))
+	}
+	if err := os.WriteFile(hf.filename, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	d := Downloader{user: "hashicorp", repository: "terraform", binaryName: "terraform", releaseTag: "v1.9.2", dataPath: tempDir}
+	target := d.versionedPath()
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(target, []byte("terraform"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(tempDir, "tf")
+	if err := linkBinary(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repairHistory(stdout, hf, []string{tempDir}, tempDir); err != nil {
+		t.Fatal(err)
+	}
+	histories, err = hf.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := histories[target]
+	if len(histories) != 1 || h == nil || h.URL != "https://github.com/hashicorp/terraform" || h.Tag != "v1.9.2" || h.Path != link || len(h.SHA256) == 0 {
+		t.Fatalf("unexpected rebuilt histories %+v", histories)
+	}
+
+	// A file of a newer obt isn't replaced.
+	newer := []byte(`{"version": 2, "histories": {}}`)
+	if err := os.WriteFile(hf.filename, newer, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := repairHistory(stdout, hf, []string{tempDir}, tempDir); !errors.Is(err, errNewerHistory) {
+		t.Fatalf("expected %v, got %v", errNewerHistory, err)
+	}
+	if b, _ := os.ReadFile(hf.filename); !bytes.Equal(b, newer) {
+		t.Fatalf("expected the history file to be kept, got '%s'", b)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/olekukonko/tablewriter/tw"
+	"github.com/y-yagi/goext/osext"
+)
+
+type staleHistory struct {
+	key    string
+	reason string
+}
+
+// findStaleHistories returns entries whose install directory or file is gone,
+// and entries for the same file as a newer entry.
+func findStaleHistories(histories map[string]*History) []staleHistory {
+	keys := make([]string, 0, len(histories))
+	for k := range histories {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var stale []staleHistory
+	files := map[string]string{}
+	for _, k := range keys {
+		h := histories[k]
+		switch {
+		case !osext.IsExist(filepath.Dir(h.installedFile())):
+			stale = append(stale, staleHistory{key: k, reason: "install directory is gone"})
+			continue
+		case !osext.IsExist(h.installedFile()):
+			stale = append(stale, staleHistory{key: k, reason: "file is missing"})
+			continue
+		}
+
+		file, err := filepath.EvalSymlinks(h.installedFile())
+		if err != nil {
+			continue
+		}
+		file, _ = filepath.Abs(file)
+
+		other, ok := files[file]
+		if !ok {
+			files[file] = k
+			continue
+		}
+
+		// Keep the entry updated last.
+		if histories[other].UpdatedAt.After(h.UpdatedAt) {
+			stale = append(stale, staleHistory{key: k, reason: fmt.Sprintf("duplicate of '%s'", other)})
+		} else {
+			stale = append(stale, staleHistory{key: other, reason: fmt.Sprintf("duplicate of '%s'", k)})
+			files[file] = k
+		}
+	}
+
+	sort.Slice(stale, func(i, j int) bool { return stale[i].key < stale[j].key })
+	return stale
+}
+
+func pruneHistories(stdout io.Writer, hf HistoryFile, confirm func() bool) error {
+	histories, err := hf.load()
+	if err != nil {
+		return err
+	}
+
+	stale := findStaleHistories(histories)
+	if len(stale) == 0 {
+		fmt.Fprintln(stdout, "No stale entries found.")
+		return nil
+	}
+
+	table := tablewriter.NewTable(stdout, tablewriter.WithSymbols(tw.NewSymbols(tw.StyleASCII)))
+	table.Header("PATH", "TAG", "REASON")
+	for _, s := range stale {
+		if err := table.Append([]string{s.key, histories[s.key].Tag, s.reason}); err != nil {
+			return err
+		}
+	}
+	if err := table.Render(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "Remove %d entries from the history. Do you want to continue?\nPlease type (y)es or (n)o and then press enter: ", len(stale))
+	if !confirm() {
+		fmt.Fprint(stdout, "canceled.\n")
+		return nil
+	}
+
+	err = hf.update(func(histories map[string]*History) error {
+		for _, s := range stale {
+			// The receipt of a duplicate may be shared with the entry kept.
+			if h, ok := histories[s.key]; ok && !osext.IsExist(h.Path) && !isSymlink(h.Path) {
+				_ = removeReceipt(h)
+			}
+			delete(histories, s.key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "Removed %d entries.\n", len(stale))
+	return nil
+}
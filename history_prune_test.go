@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistoryFilePrune(t *testing.T) {
+	tempDir := t.TempDir()
+	bin := filepath.Join(tempDir, "bin")
+	if err := os.MkdirAll(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(bin, filepath.Join(tempDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	hf := HistoryFile{filename: filepath.Join(tempDir, "history")}
+	save := func(file string) {
+		if err := hf.save(Downloader{releaseTag: "v1.0.0"}, "https://github.com/owner/tool", file, "", "tool"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tool := filepath.Join(bin, "tool")
+	if err := os.WriteFile(tool, []byte("tool"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	save(filepath.Join(tempDir, "link", "tool"))
+	save(filepath.Join(bin, "missing"))
+	save(filepath.Join(tempDir, "gone", "tool"))
+	time.Sleep(time.Second)
+	save(tool)
+
+	histories, err := hf.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []staleHistory{
+		{filepath.Join(bin, "missing"), "file is missing"},
+		{filepath.Join(tempDir, "gone", "tool"), "install directory is gone"},
+		{filepath.Join(tempDir, "link", "tool"), "duplicate of '" + tool + "'"},
+	}
+	got := findStaleHistories(histories)
+	if len(got) != len(want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %+v, got %+v", want[i], got[i])
+		}
+	}
+
+	stdout := new(bytes.Buffer)
+	if err := pruneHistories(stdout, hf, func() bool { return false }); err != nil {
+		t.Fatal(err)
+	}
+	if histories, _ = hf.load(); len(histories) != 4 {
+		t.Fatalf("expected nothing to be removed when canceled, got %d entries", len(histories))
+	}
+
+	if err := pruneHistories(stdout, hf, func() bool { return true }); err != nil {
+		t.Fatal(err)
+	}
+	if histories, _ = hf.load(); len(histories) != 1 || histories[tool] == nil {
+		t.Fatalf("expected only '%s' to be kept, got %+v", tool, histories)
+	}
+}
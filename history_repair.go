@@ -0,0 +1,170 @@
+package main
+
+import (
+	"debug/buildinfo"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/y-yagi/goext/osext"
+)
+
+// repairHistory restores a broken history file from the newest backup that
+// can be read. Without one, the histories are rebuilt by scanning the install
+// paths, their receipts and the versioned layout in the data directory.
+func repairHistory(stdout io.Writer, hf HistoryFile, binDirs []string, dataDir string) error {
+	unlock, err := hf.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if osext.IsExist(hf.filename) {
+		b, err := os.ReadFile(hf.filename)
+		if err != nil {
+			return err
+		}
+		_, _, err = decodeHistoryFile(b)
+		if err == nil {
+			fmt.Fprintf(stdout, "'%s' isn't broken.\n", hf.filename)
+			return nil
+		}
+		// A file of a newer obt is valid and must not be replaced.
+		if errors.Is(err, errNewerHistory) {
+			return err
+		}
+
+		if err := os.Rename(hf.filename, hf.filename+".broken"); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Move the broken history file to '%s'.\n", hf.filename+".broken")
+	}
+
+	backups := []string{}
+	for i := 1; i <= maxHistoryBackups; i++ {
+		backups = append(backups, hf.backupName(i))
+	}
+	backups = append(backups, hf.filename+".gob.bak")
+
+	for _, backup := range backups {
+		b, err := os.ReadFile(backup)
+		if err != nil {
+			continue
+		}
+		histories, _, err := decodeHistoryFile(b)
+		if err != nil {
+			continue
+		}
+
+		if err := hf.write(histories); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Restore %d histories from '%s'.\n", len(histories), backup)
+		return nil
+	}
+
+	histories := rebuildHistories(binDirs, dataDir)
+	if err := hf.write(histories); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "No backup can be read. Rebuild %d histories by scanning the install path.\n", len(histories))
+	return nil
+}
+
+// rebuildHistories creates histories from the versioned layout
+// "<data>/tools/<owner>/<repo>/<tag>/<binary>" and from the build info Go
+// embeds in binaries in binDirs. Receipts in binDirs take precedence, since
+// they have everything recorded at install time.
+func rebuildHistories(binDirs []string, dataDir string) map[string]*History {
+	histories := map[string]*History{}
+
+	links := map[string]string{}
+	for _, binDir := range binDirs {
+		entries, _ := os.ReadDir(binDir)
+		for _, e := range entries {
+			file := filepath.Join(binDir, e.Name())
+			if dest, err := os.Readlink(file); err == nil {
+				links[dest] = file
+			}
+		}
+	}
+
+	if len(dataDir) != 0 && len(binDirs) != 0 {
+		pattern := filepath.Join(dataDir, "tools", "*", "*", "*", "*")
+		matches, _ := filepath.Glob(pattern)
+		for _, target := range matches {
+			rel, _ := filepath.Rel(filepath.Join(dataDir, "tools"), target)
+			parts := strings.Split(filepath.ToSlash(rel), "/")
+			name := parts[3]
+
+			link, ok := links[target]
+			if !ok {
+				link = filepath.Join(binDirs[0], name)
+			}
+
+			h := &History{URL: "https://github.com/" + parts[0] + "/" + parts[1], Tag: parts[2], Path: link, Target: target, BinaryName: strings.TrimSuffix(name, ".exe")}
+			addFileMetadata(h, target)
+			histories[h.key()] = h
+		}
+	}
+
+	for _, binDir := range binDirs {
+		entries, _ := os.ReadDir(binDir)
+		for _, e := range entries {
+			file := filepath.Join(binDir, e.Name())
+			if !e.Type().IsRegular() {
+				continue
+			}
+
+			h, ok := historyFromBuildInfo(file)
+			if !ok {
+				continue
+			}
+			addFileMetadata(h, file)
+			histories[h.key()] = h
+		}
+
+		for _, h := range readReceipts(binDir) {
+			histories[h.key()] = h
+		}
+	}
+
+	return histories
+}
+
+// historyFromBuildInfo reads the module path and version of a Go binary,
+// e.g. "github.com/owner/repo/cmd/tool" at "v1.2.3". The tag is left empty
+// for "(devel)" and pseudo-versions, which no release has.
+func historyFromBuildInfo(file string) (*History, bool) {
+	info, err := buildinfo.ReadFile(file)
+	if err != nil {
+		return nil, false
+	}
+
+	parts := strings.Split(info.Main.Path, "/")
+	if len(parts) < 3 || parts[0] != "github.com" {
+		return nil, false
+	}
+
+	name := strings.TrimSuffix(filepath.Base(file), ".exe")
+	h := &History{URL: "https://github.com/" + parts[1] + "/" + parts[2], Path: file, BinaryName: name}
+	if isModuleRelease(info.Main.Version) {
+		h.Tag = info.Main.Version
+	}
+	return h, true
+}
+
+func addFileMetadata(h *History, file string) {
+	h.Host = "github.com"
+	h.SHA256, _ = sha256File(file)
+	if fi, err := os.Stat(file); err == nil {
+		h.Size = fi.Size()
+		h.Mode = fi.Mode().Perm()
+		h.InstalledAt = fi.ModTime().UTC().Truncate(time.Second)
+		h.UpdatedAt = h.InstalledAt
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+var supportedLibcs = []string{"gnu", "musl"}
+
+// detectLibc reports the libc of the running system. musl is recognised by
+// its dynamic loader, or by the ELF interpreter of /bin/sh.
+func detectLibc() string {
+	if runtime.GOOS != "linux" {
+		return ""
+	}
+
+	if matches, _ := filepath.Glob("/lib/ld-musl-*"); len(matches) > 0 {
+		return "musl"
+	}
+
+	interpreter, err := elfInterpreter("/bin/sh")
+	if err == nil && strings.Contains(interpreter, "musl") {
+		return "musl"
+	}
+
+	return "gnu"
+}
+
+func isSupportedLibc(libc string) bool {
+	for _, v := range supportedLibcs {
+		if v == libc {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"debug/elf"
+	endian "encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ldSoCachePath  = "/etc/ld.so.cache"
+	ldSoConfPath   = "/etc/ld.so.conf"
+	ldSoCacheMagic = "glibc-ld.so.cache1.1"
+)
+
+var defaultLibraryDirs = []string{"/lib64", "/usr/lib64", "/lib", "/usr/lib", "/usr/local/lib"}
+
+// libraryResolver finds shared libraries the way the dynamic loader does:
+// RPATH/RUNPATH, LD_LIBRARY_PATH, ld.so.cache, ld.so.conf and the default
+// directories.
+type libraryResolver struct {
+	cache map[string][]string
+	dirs  []string
+}
+
+func newLibraryResolver() *libraryResolver {
+	r := &libraryResolver{cache: map[string][]string{}}
+
+	if b, err := os.ReadFile(ldSoCachePath); err == nil {
+		r.cache = parseLdSoCache(b)
+	}
+
+	r.dirs = append(r.dirs, filepath.SplitList(os.Getenv("LD_LIBRARY_PATH"))...)
+	r.dirs = append(r.dirs, parseLdSoConf(ldSoConfPath, map[string]bool{})...)
+	r.dirs = append(r.dirs, muslLibraryDirs()...)
+	r.dirs = append(r.dirs, defaultLibraryDirs...)
+	return r
+}
+
+// missingLibraries returns the interpreter and DT_NEEDED entries of file that
+// can't be found on this system.
+func (r *libraryResolver) missingLibraries(file string) ([]string, error) {
+	f, err := elf.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var missing []string
+
+	interpreter, err := interpreterOf(f)
+	if err != nil {
+		return nil, err
+	}
+	if len(interpreter) == 0 {
+		return nil, nil
+	}
+	if _, err := os.Stat(interpreter); err != nil {
+		missing = append(missing, interpreter)
+	}
+
+	needed, err := f.ImportedLibraries()
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs []string
+	for _, tag := range []elf.DynTag{elf.DT_RPATH, elf.DT_RUNPATH} {
+		paths, _ := f.DynString(tag)
+		for _, p := range paths {
+			p = strings.ReplaceAll(p, "$ORIGIN", filepath.Dir(file))
+			dirs = append(dirs, filepath.SplitList(p)...)
+		}
+	}
+	dirs = append(dirs, r.dirs...)
+
+	for _, lib := range needed {
+		if !r.resolve(lib, dirs, f) {
+			missing = append(missing, lib)
+		}
+	}
+
+	return missing, nil
+}
+
+func (r *libraryResolver) resolve(lib string, dirs []string, target *elf.File) bool {
+	if strings.Contains(lib, "/") {
+		return isCompatibleLibrary(lib, target)
+	}
+
+	candidates := append([]string{}, r.cache[lib]...)
+	for _, dir := range dirs {
+		candidates = append(candidates, filepath.Join(dir, lib))
+	}
+
+	for _, c := range candidates {
+		if isCompatibleLibrary(c, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func isCompatibleLibrary(path string, target *elf.File) bool {
+	f, err := elf.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	return f.Machine == target.Machine && f.Class == target.Class
+}
+
+// parseLdSoCache reads the "new" ld.so.cache format, which is either the
+// whole file or appended to an old format cache.
+func parseLdSoCache(b []byte) map[string][]string {
+	libs := map[string][]string{}
+
+	start := bytes.Index(b, []byte(ldSoCacheMagic))
+	if start < 0 {
+		return libs
+	}
+	b = b[start:]
+
+	const headerSize, entrySize = 48, 24
+	if len(b) < headerSize {
+		return libs
+	}
+
+	n := int(endian.LittleEndian.Uint32(b[20:24]))
+	for i := 0; i < n; i++ {
+		off := headerSize + i*entrySize
+		if off+entrySize > len(b) {
+			break
+		}
+
+		key := cString(b, endian.LittleEndian.Uint32(b[off+4:off+8]))
+		value := cString(b, endian.LittleEndian.Uint32(b[off+8:off+12]))
+		if len(key) != 0 && len(value) != 0 {
+			libs[key] = append(libs[key], value)
+		}
+	}
+
+	return libs
+}
+
+func cString(b []byte, off uint32) string {
+	if int(off) >= len(b) {
+		return ""
+	}
+
+	s := b[off:]
+	if i := bytes.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return string(s)
+}
+
+func parseLdSoConf(file string, seen map[string]bool) []string {
+	if seen[file] {
+		return nil
+	}
+	seen[file] = true
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var dirs []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+
+		switch {
+		case len(line) == 0:
+		case strings.HasPrefix(line, "include "):
+			pattern := strings.TrimSpace(strings.TrimPrefix(line, "include "))
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(filepath.Dir(file), pattern)
+			}
+
+			matches, _ := filepath.Glob(pattern)
+			for _, m := range matches {
+				dirs = append(dirs, parseLdSoConf(m, seen)...)
+			}
+		default:
+			dirs = append(dirs, line)
+		}
+	}
+
+	return dirs
+}
+
+func muslLibraryDirs() []string {
+	matches, _ := filepath.Glob("/etc/ld-musl-*.path")
+
+	var dirs []string
+	for _, m := range matches {
+		b, err := os.ReadFile(m)
+		if err != nil {
+			continue
+		}
+		dirs = append(dirs, strings.FieldsFunc(string(b), func(r rune) bool { return r == ':' || r == '\n' })...)
+	}
+	return dirs
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	endian "encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseLdSoCache(t *testing.T) {
+	strs := "libz.so.1\x00/usr/lib/libz.so.1\x00"
+	header := make([]byte, 48)
+	copy(header, ldSoCacheMagic)
+	endian.LittleEndian.PutUint32(header[20:], 1)
+
+	entry := make([]byte, 24)
+	strOff := uint32(len(header) + len(entry))
+	endian.LittleEndian.PutUint32(entry[4:], strOff)
+	endian.LittleEndian.PutUint32(entry[8:], strOff+uint32(len("libz.so.1\x00")))
+
+	b := append(append(header, entry...), strs...)
+	got := parseLdSoCache(append([]byte("ld.so-1.7.0\x00\x00\x00\x00"), b...))
+
+	want := map[string][]string{"libz.so.1": {"/usr/lib/libz.so.1"}}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestParseLdSoConf(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "obttest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	conf := filepath.Join(tempDir, "ld.so.conf")
+	os.Mkdir(filepath.Join(tempDir, "ld.so.conf.d"), 0755)
+	os.WriteFile(conf, []byte("# comment\n/opt/lib\ninclude ld.so.conf.d/*.conf\n"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "ld.so.conf.d", "a.conf"), []byte("/usr/lib/x86_64-linux-gnu\n"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "ld.so.conf.d", "b.conf"), []byte("include "+conf+"\n/usr/local/lib/b\n"), 0644)
+
+	got := parseLdSoConf(conf, map[string]bool{})
+	want := []string{"/opt/lib", "/usr/lib/x86_64-linux-gnu", "/usr/local/lib/b"}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestMissingLibraries(t *testing.T) {
+	interpreter, err := elfInterpreter("/bin/sh")
+	if err != nil || len(interpreter) == 0 {
+		t.Skip("/bin/sh isn't a dynamically linked ELF file")
+	}
+
+	missing, err := newLibraryResolver().missingLibraries("/bin/sh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 0 {
+		t.Fatalf("expected all libraries of /bin/sh to be found, but missing %v", missing)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// Limits protects against broken or malicious releases. Zero values use the
+// defaults.
+type Limits struct {
+	MaxDownloadSize   int64 `toml:"max_download_size,omitempty"`
+	MaxEntrySize      int64 `toml:"max_entry_size,omitempty"`
+	MaxExpansionRatio int64 `toml:"max_expansion_ratio,omitempty"`
+	MaxEntries        int   `toml:"max_entries,omitempty"`
+}
+
+// minExpandedSize is the size below which the expansion ratio isn't checked,
+// since tiny downloads can have any ratio.
+const minExpandedSize = 1 << 20
+
+var defaultLimits = Limits{
+	MaxDownloadSize:   1 << 30,
+	MaxEntrySize:      1 << 30,
+	MaxExpansionRatio: 200,
+	MaxEntries:        100000,
+}
+
+func (l Limits) withDefaults() Limits {
+	if l.MaxDownloadSize <= 0 {
+		l.MaxDownloadSize = defaultLimits.MaxDownloadSize
+	}
+	if l.MaxEntrySize <= 0 {
+		l.MaxEntrySize = defaultLimits.MaxEntrySize
+	}
+	if l.MaxExpansionRatio <= 0 {
+		l.MaxExpansionRatio = defaultLimits.MaxExpansionRatio
+	}
+	if l.MaxEntries <= 0 {
+		l.MaxEntries = defaultLimits.MaxEntries
+	}
+	return l
+}
+
+type sizeGuard struct {
+	limits     Limits
+	compressed int64
+	expanded   int64
+	entries    int
+	counting   bool
+}
+
+// guardedReader keeps returning the error of count once it fails, since a
+// bufio.Reader may drop the error when peeking.
+type guardedReader struct {
+	r     io.Reader
+	count func(n int) error
+	err   error
+}
+
+func (g *guardedReader) Read(p []byte) (int, error) {
+	if g.err != nil {
+		return 0, g.err
+	}
+
+	n, err := g.r.Read(p)
+	if n > 0 {
+		if g.err = g.count(n); g.err != nil {
+			return n, g.err
+		}
+	}
+	return n, err
+}
+
+func (d *Downloader) sizeGuard() *sizeGuard {
+	if d.guard == nil {
+		d.guard = &sizeGuard{limits: d.limits.withDefaults()}
+	}
+	return d.guard
+}
+
+// guardDownload counts the bytes of the download itself.
+func (d *Downloader) guardDownload(r io.Reader) io.Reader {
+	g := d.sizeGuard()
+	g.counting = true
+
+	return &guardedReader{r: r, count: func(n int) error {
+		g.compressed += int64(n)
+		if g.compressed > g.limits.MaxDownloadSize {
+			return fmt.Errorf("download is larger than the limit of %d bytes", g.limits.MaxDownloadSize)
+		}
+		return nil
+	}}
+}
+
+// guardExpanded counts the output of a decompressor and stops when it
+// expands too much compared to the bytes downloaded so far.
+func (d *Downloader) guardExpanded(r io.Reader) io.Reader {
+	g := d.sizeGuard()
+
+	return &guardedReader{r: r, count: func(n int) error {
+		g.expanded += int64(n)
+		if g.counting && g.expanded > minExpandedSize && g.expanded > g.compressed*g.limits.MaxExpansionRatio {
+			return fmt.Errorf("archive expands more than %d times its download size. It may be a decompression bomb", g.limits.MaxExpansionRatio)
+		}
+		return nil
+	}}
+}
+
+// countEntry is called for every entry of an archive.
+func (d *Downloader) countEntry() error {
+	g := d.sizeGuard()
+	g.entries++
+	if g.entries > g.limits.MaxEntries {
+		return fmt.Errorf("archive has more than %d entries", g.limits.MaxEntries)
+	}
+	return nil
+}
+
+func (d *Downloader) checkEntrySize(name string, size int64) error {
+	if max := d.sizeGuard().limits.MaxEntrySize; size > max {
+		return fmt.Errorf("'%s' is larger than the limit of %d bytes", name, max)
+	}
+	return nil
+}
+
+// readEntry reads an uncompressed file. size is the size recorded in the
+// archive, or -1 when unknown.
+func (d *Downloader) readEntry(name string, r io.Reader, size int64) ([]byte, error) {
+	if err := d.checkEntrySize(name, size); err != nil {
+		return nil, err
+	}
+
+	max := d.sizeGuard().limits.MaxEntrySize
+	bs, err := io.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(bs)) > max {
+		return nil, d.checkEntrySize(name, int64(len(bs)))
+	}
+	return bs, nil
+}
+
+// checkReceivedSize compares the bytes received with the asset size reported
+// by the API. The rest of the body is read, since extractors may stop early.
+func (d *Downloader) checkReceivedSize(body io.Reader) error {
+	if _, err := io.Copy(io.Discard, body); err != nil {
+		return err
+	}
+
+	g := d.sizeGuard()
+	if d.assetSize > 0 && g.compressed != d.assetSize {
+		return fmt.Errorf("received %d bytes, but the asset size is %d bytes", g.compressed, d.assetSize)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func serveFixture(t *testing.T, fixture string) *httptest.Server {
+	buf, err := os.ReadFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Without Content-Length, like a chunked response.
+		w.(http.Flusher).Flush()
+		w.Write(buf)
+	}))
+}
+
+func TestLimits(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "obttest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	var tests = []struct {
+		name      string
+		fixture   string
+		fType     fileType
+		limits    Limits
+		assetSize int64
+		wantErr   string
+	}{
+		{"decompression bomb", "testdata/bomb.tar.gz", tarGzType, Limits{}, 0, "decompression bomb"},
+		{"too many entries", "testdata/many_entries.tar.gz", tarGzType, Limits{MaxEntries: 10}, 0, "more than 10 entries"},
+		{"large entry", "testdata/sample.tar.gz", tarGzType, Limits{MaxEntrySize: 3}, 0, "'sample.txt' is larger than the limit of 3 bytes"},
+		{"large compressed file", "testdata/sample.gzip", gzipType, Limits{MaxEntrySize: 3}, 0, "larger than the limit of 3 bytes"},
+		{"large download", "testdata/sample.zip", zipType, Limits{MaxDownloadSize: 100}, 0, "download is larger than the limit of 100 bytes"},
+		{"size mismatch", "testdata/sample.gzip", gzipType, Limits{}, 1000, "received 38 bytes, but the asset size is 1000 bytes"},
+		{"not binary", "testdata/sample.gzip", gzipType, Limits{}, 0, "downloaded file is not binary"},
+	}
+
+	// A failed download keeps the binary already installed.
+	file := filepath.Join(tempDir, "sample")
+	if err := os.WriteFile(file, []byte("installed"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		ts := serveFixture(t, tt.fixture)
+
+		d := Downloader{binaryName: "sample.txt", url: ts.URL, fType: tt.fType, limits: tt.limits, assetSize: tt.assetSize}
+		err := d.execute(file)
+		ts.Close()
+
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Fatalf("%s: expected error with '%s', got %v", tt.name, tt.wantErr, err)
+		}
+
+		if b, _ := os.ReadFile(file); string(b) != "installed" {
+			t.Fatalf("%s: expected the installed binary to be kept, got '%s'", tt.name, b)
+		}
+		if entries, _ := os.ReadDir(tempDir); len(entries) != 1 {
+			t.Fatalf("%s: expected no temporary files, got %d entries", tt.name, len(entries))
+		}
+	}
+}
+
+func TestLimitsWithDefaults(t *testing.T) {
+	got := Limits{MaxEntries: 10}.withDefaults()
+	want := defaultLimits
+	want.MaxEntries = 10
+
+	if got != want {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+}
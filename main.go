@@ -8,7 +8,9 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/olekukonko/tablewriter"
 	"github.com/olekukonko/tablewriter/tw"
@@ -26,20 +28,39 @@ var (
 	flags           *flag.FlagSet
 	showVersion     bool
 	showInstalled   bool
+	longFormat      bool
+	fixInstalls     bool
 	updateAll       bool
+	skipMissing     bool
 	tmpInstallPath  string
 	defaultPath     string
 	binaryName      string
+	outputName      string
 	releaseTag      string
+	libcName        string
+	targetOS        string
+	targetArch      string
+	strictLibs      bool
+	appImageExtract bool
+	allowScript     bool
+	pathInArchive   string
+	versioned       bool
 	historyFilePath string
 
 	version = "devel"
 )
 
 type Config struct {
-	Path            string `toml:"path"`
-	CachePath       string `toml:"cache_path"`
-	HistoryFilePath string `toml:"history_file_path"`
+	Path            string              `toml:"path"`
+	CachePath       string              `toml:"cache_path"`
+	DataPath        string              `toml:"data_path"`
+	HistoryFilePath string              `toml:"history_file_path"`
+	OSAliases       map[string][]string `toml:"os_aliases,omitempty"`
+	ArchAliases     map[string][]string `toml:"arch_aliases,omitempty"`
+	Versioned       bool                `toml:"versioned"`
+	VersionCommands map[string]string   `toml:"version_commands,omitempty"`
+	BinDirs         []string            `toml:"bin_dirs,omitempty"`
+	Limits          Limits              `toml:"limits"`
 }
 
 func main() {
@@ -51,17 +72,39 @@ func setFlags() {
 	flags = flag.NewFlagSet(cmd, flag.ExitOnError)
 	flags.BoolVar(&showVersion, "v", false, "print version number")
 	flags.BoolVar(&showInstalled, "installed", false, "show installed binaries")
+	flags.BoolVar(&longFormat, "l", false, "show details of installed binaries (with -installed)")
+	flags.BoolVar(&fixInstalls, "fix", false, "reinstall binaries that don't match the history (with verify)")
 	flags.BoolVar(&updateAll, "U", false, "update all installed binaries")
+	flags.BoolVar(&skipMissing, "skip-missing", false, "skip binaries whose file is missing (with -U)")
 	flags.StringVar(&tmpInstallPath, "p", "", "temporary install path")
 	flags.StringVar(&defaultPath, "s", "", "set default install path")
 	flags.StringVar(&binaryName, "b", "", "binary name")
+	flags.StringVar(&outputName, "o", "", "install the binary under this file name (default: binary name)")
 	flags.StringVar(&releaseTag, "tag", "", "release tag")
+	flags.StringVar(&targetOS, "os", "", "target OS (default: running OS)")
+	flags.StringVar(&targetArch, "arch", "", "target architecture (default: running architecture)")
+	flags.StringVar(&libcName, "libc", "", "libc variant to install (gnu or musl, default: detected)")
+	flags.BoolVar(&strictLibs, "strict-libs", false, "fail the install when shared libraries are missing")
+	flags.BoolVar(&appImageExtract, "appimage-extract", false, "extract an AppImage and install its AppRun (for hosts without FUSE)")
+	flags.BoolVar(&allowScript, "allow-script", false, "allow installing a script with a shebang instead of a binary")
+	flags.StringVar(&pathInArchive, "path-in-archive", "", "glob for the path of the binary in an archive (e.g. 'tool-*/bin/tool')")
+	flags.BoolVar(&versioned, "versioned", false, "install to the data directory per release and link it from the install path")
 	flags.StringVar(&historyFilePath, "history", "", "set history file path")
 	flags.Usage = usage
 }
 
 func usage() {
-	fmt.Fprintf(os.Stderr, "Usage: %s [OPTIONS] URL\n\n", cmd)
+	fmt.Fprintf(os.Stderr, "Usage: %s [OPTIONS] URL\n", cmd)
+	fmt.Fprintf(os.Stderr, "       %s explain [OPTIONS] URL\n", cmd)
+	fmt.Fprintf(os.Stderr, "       %s versions TOOL\n", cmd)
+	fmt.Fprintf(os.Stderr, "       %s use TOOL TAG\n", cmd)
+	fmt.Fprintf(os.Stderr, "       %s shim TOOL...\n", cmd)
+	fmt.Fprintf(os.Stderr, "       %s exec TOOL [ARGS]\n", cmd)
+	fmt.Fprintf(os.Stderr, "       %s verify [-fix]\n", cmd)
+	fmt.Fprintf(os.Stderr, "       %s outdated\n", cmd)
+	fmt.Fprintf(os.Stderr, "       %s doctor\n", cmd)
+	fmt.Fprintf(os.Stderr, "       %s adopt PATH [REPOSITORY]\n", cmd)
+	fmt.Fprintf(os.Stderr, "       %s history export [FILE] | import FILE | repair | prune | scan [DIR...]\n\n", cmd)
 	fmt.Fprintf(os.Stderr, "Install binary file from GitHub's release page. Default install path is '%s'.\n\n", cfg.Path)
 	fmt.Fprintln(os.Stderr, "OPTIONS:")
 	flags.PrintDefaults()
@@ -78,6 +121,7 @@ func msg(err error, stderr io.Writer) int {
 func run(args []string, stdout, stderr io.Writer) int {
 	logger = debuglog.New(stdout)
 	configure.Load(cmd, &cfg)
+	aliases = newAliasTable(cfg.OSAliases, cfg.ArchAliases)
 
 	flags.Parse(args[1:])
 
@@ -86,6 +130,36 @@ func run(args []string, stdout, stderr io.Writer) int {
 		return 0
 	}
 
+	if flags.NArg() > 0 {
+		switch flags.Arg(0) {
+		case "explain":
+			flags.Parse(flags.Args()[1:])
+			return msg(explain(stdout), stderr)
+		case "versions":
+			return msg(showVersions(stdout, flags.Args()[1:]), stderr)
+		case "use":
+			return msg(useVersion(stdout, flags.Args()[1:]), stderr)
+		case "shim":
+			return msg(writeShims(stdout, flags.Args()[1:]), stderr)
+		case "exec":
+			return execTool(stdout, stderr, flags.Args()[1:])
+		case "verify":
+			flags.Parse(flags.Args()[1:])
+			v := Verifier{stdout: stdout, stderr: stderr, historyFilePath: determineHistoryFilePath(), cachePath: determineCachePath(), dataPath: determineDataPath(), limits: cfg.Limits, fix: fixInstalls}
+			return msg(v.execute(), stderr)
+		case "outdated":
+			o := Outdated{stdout: stdout, historyFilePath: determineHistoryFilePath(), cachePath: determineCachePath(), dataPath: determineDataPath(), limits: cfg.Limits}
+			return msg(o.execute(), stderr)
+		case "doctor":
+			dr := newDoctor(stdout)
+			return msg(dr.execute(), stderr)
+		case "adopt":
+			return msg(adoptBinary(stdout, stderr, flags.Args()[1:]), stderr)
+		case "history":
+			return msg(historyCommand(stdout, flags.Args()[1:]), stderr)
+		}
+	}
+
 	if showInstalled {
 		return msg(showInstalledBinaries(stdout), stderr)
 	}
@@ -121,7 +195,7 @@ func run(args []string, stdout, stderr io.Writer) int {
 			return 0
 		}
 
-		u := Updater{stdout: stdout, stderr: stderr, historyFilePath: determineHistoryFilePath(), cachePath: cfg.CachePath}
+		u := Updater{stdout: stdout, stderr: stderr, historyFilePath: determineHistoryFilePath(), cachePath: cfg.CachePath, dataPath: determineDataPath(), limits: cfg.Limits, skipMissing: skipMissing}
 		return msg(u.execute(), stderr)
 	}
 
@@ -134,23 +208,19 @@ func download(stdout, stderr io.Writer) error {
 		return nil
 	}
 
-	url := strings.TrimSuffix(flags.Args()[0], "/")
-	a := strings.Split(url, "/")
-
-	if len(a) < 2 {
+	url, user, repository, ok := parseRepositoryURL(flags.Args()[0])
+	if !ok {
 		flags.Usage()
 		return nil
 	}
 
-	if len(cfg.CachePath) == 0 {
-		dir, err := os.UserCacheDir()
-		if err == nil {
-			cfg.CachePath = filepath.Join(dir, cmd)
-		}
+	downloader, err := newDownloader(user, repository)
+	if err != nil {
+		return err
 	}
+	downloader.stderr = stderr
 
-	downloader := Downloader{user: a[len(a)-2], repository: a[len(a)-1], binaryName: binaryName, cachePath: cfg.CachePath, releaseTag: releaseTag}
-	err := downloader.findDownloadURL()
+	err = downloader.findDownloadURL()
 	if err != nil {
 		return err
 	}
@@ -164,9 +234,21 @@ func download(stdout, stderr io.Writer) error {
 		return err
 	}
 
-	file := filepath.Join(strings.TrimSuffix(path, "\n"), downloader.binaryName)
+	file := filepath.Join(strings.TrimSuffix(path, "\n"), downloader.installName())
+	target := file
+	useVersioned := versioned || cfg.Versioned
 
-	if osext.IsExist(file) {
+	if useVersioned {
+		if len(downloader.dataPath) == 0 {
+			return errors.New("can't determine the data directory. Please set 'data_path' in the config")
+		}
+		target = downloader.versionedPath()
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+	}
+
+	if osext.IsExist(file) && !(useVersioned && (isSymlink(file) || isShim(file))) {
 		fmt.Fprintf(stdout, "'%s' exists. Override a file?\nPlease type (y)es or (n)o and then press enter: ", file)
 		if !askForConfirmation(stdout) {
 			fmt.Fprint(stdout, "download canceled.\n")
@@ -174,23 +256,105 @@ func download(stdout, stderr io.Writer) error {
 		}
 	}
 
-	err = downloader.execute(file)
+	err = downloader.execute(target)
 	if err != nil {
 		return err
 	}
 
+	if useVersioned {
+		if err := activateVersion(target, file); err != nil {
+			return err
+		}
+	} else {
+		target = ""
+	}
+
 	if len(tmpInstallPath) == 0 {
 		hf := HistoryFile{filename: determineHistoryFilePath()}
-		err = hf.save(downloader, url, file, downloader.binaryName)
+		err = hf.save(downloader, url, file, target, downloader.binaryName)
 		if err != nil {
 			fmt.Fprintf(stderr, "history save error %v\n", err)
 		}
 	}
 
 	fmt.Fprintf(stdout, "Download '%s(%s)' to '%s'.\n", downloader.binaryName, downloader.releaseTag, file)
+	if downloader.info != nil {
+		fmt.Fprintf(stdout, "'%s' is a %v.\n", downloader.binaryName, downloader.info)
+	}
+	if len(downloader.missing) > 0 {
+		fmt.Fprintf(stderr, "warning: '%s' needs shared libraries that can't be found: %s.%s\n", file, strings.Join(downloader.missing, ", "), downloader.alternativeAssetHint())
+	}
 	return nil
 }
 
+func newDownloader(user, repository string) (Downloader, error) {
+	d := Downloader{user: user, repository: repository, binaryName: binaryName, outputName: outputName, cachePath: determineCachePath(), releaseTag: releaseTag, libc: libcName, strictLibs: strictLibs, dataPath: determineDataPath(), appImage: appImageExtract, allowScript: allowScript, pathInArchive: pathInArchive, limits: cfg.Limits}
+
+	if len(targetOS) > 0 {
+		goos, ok := aliases.canonical(osToken, targetOS)
+		if !ok {
+			return d, fmt.Errorf("unknown OS '%s'", targetOS)
+		}
+		d.goos = goos
+	}
+
+	if len(targetArch) > 0 {
+		goarch, ok := aliases.canonical(archToken, targetArch)
+		if !ok {
+			return d, fmt.Errorf("unknown architecture '%s'", targetArch)
+		}
+		d.goarch = goarch
+	}
+
+	if len(outputName) > 0 && (strings.ContainsAny(outputName, `/\`) || outputName == "." || outputName == "..") {
+		return d, fmt.Errorf("invalid output name '%s'. Please specify a file name, not a path", outputName)
+	}
+
+	if len(libcName) > 0 && !isSupportedLibc(libcName) {
+		return d, fmt.Errorf("unsupported libc '%s'. Please specify one of %v", libcName, supportedLibcs)
+	}
+
+	return d, nil
+}
+
+func parseRepositoryURL(arg string) (url, user, repository string, ok bool) {
+	url = strings.TrimSuffix(arg, "/")
+	a := strings.Split(url, "/")
+
+	if len(a) < 2 {
+		return "", "", "", false
+	}
+
+	return url, a[len(a)-2], a[len(a)-1], true
+}
+
+func determineCachePath() string {
+	if len(cfg.CachePath) == 0 {
+		dir, err := os.UserCacheDir()
+		if err == nil {
+			cfg.CachePath = filepath.Join(dir, cmd)
+		}
+	}
+
+	return cfg.CachePath
+}
+
+func determineDataPath() string {
+	if len(cfg.DataPath) > 0 {
+		return cfg.DataPath
+	}
+
+	if dir := os.Getenv("XDG_DATA_HOME"); len(dir) > 0 {
+		return filepath.Join(dir, cmd)
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".local", "share", cmd)
+}
+
 func determinePath() (string, error) {
 	if len(tmpInstallPath) > 0 {
 		return tmpInstallPath, nil
@@ -237,11 +401,37 @@ func showInstalledBinaries(stdout io.Writer) error {
 		return err
 	}
 
+	keys := make([]string, 0, len(histories))
+	for k := range histories {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
 	table := tablewriter.NewTable(stdout, tablewriter.WithSymbols(tw.NewSymbols(tw.StyleASCII)))
-	table.Header("URL", "TAG", "PATH")
+	if longFormat {
+		table.Header("URL", "TAG", "BINARY", "PREVIOUS", "PATH", "ASSET", "SIZE", "TYPE", "PLATFORM", "SHA256", "INSTALLED", "UPDATED")
+	} else {
+		table.Header("URL", "TAG", "PATH")
+	}
+
+	for _, k := range keys {
+		h := histories[k]
 
-	for _, h := range histories {
-		err := table.Append([]string{h.URL, h.Tag, h.Path})
+		// Flag binaries replaced by a different version.
+		tag, detected := h.Tag, ""
+		if v, mismatch := h.versionMismatch(); mismatch {
+			tag = fmt.Sprintf("%s (binary: %s)", h.Tag, v.version)
+			detected = fmt.Sprintf("%s (%s)", v.version, v.source)
+		} else if len(v.version) != 0 {
+			detected = fmt.Sprintf("%s (%s)", v.version, v.source)
+		}
+
+		row := []string{h.URL, tag, h.Path}
+		if longFormat {
+			row = []string{h.URL, tag, detected, h.PreviousTag, h.Path, h.AssetName, formatSize(h.AssetSize), h.FileType, formatPlatform(h), shortHash(h.SHA256), formatTime(h.InstalledAt), formatTime(h.UpdatedAt)}
+		}
+
+		err := table.Append(row)
 		if err != nil {
 			return err
 		}
@@ -253,3 +443,46 @@ func showInstalledBinaries(stdout io.Writer) error {
 	}
 	return nil
 }
+
+func formatSize(size int64) string {
+	if size <= 0 {
+		return ""
+	}
+
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func formatPlatform(h *History) string {
+	if len(h.OS) == 0 {
+		return ""
+	}
+
+	platform := h.OS + "/" + h.Arch
+	if len(h.Libc) != 0 {
+		platform += " (" + h.Libc + ")"
+	}
+	return platform
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/y-yagi/goext/osext"
@@ -70,9 +71,18 @@ func TestDownloadRustPackage(t *testing.T) {
 
 func TestShowHistory(t *testing.T) {
 	setFlags()
+	// Loading migrates the gob file, so a copy is used.
+	tempDir := t.TempDir()
+	b, err := os.ReadFile("testdata/history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "history"), b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
 	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
-	abs, _ := filepath.Abs("./testdata/")
-	run([]string{"obt", "-history", abs}, stdout, stderr)
+	run([]string{"obt", "-history", tempDir}, stdout, stderr)
 
 	stdout, stderr = new(bytes.Buffer), new(bytes.Buffer)
 	run([]string{"obt", "-installed"}, stdout, stderr)
@@ -102,3 +112,76 @@ func TestSetInvalidPathToDefaultPath(t *testing.T) {
 		t.Fatalf("expected \n%s\n\nbut got \n\n%s\n", want, got)
 	}
 }
+
+func TestVersions(t *testing.T) {
+	tempDir := t.TempDir()
+	orig := cfg
+	defer func() { cfg = orig }()
+	cfg.HistoryFilePath = tempDir
+
+	link := filepath.Join(tempDir, "bin", "terraform")
+	if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	hf := HistoryFile{filename: determineHistoryFilePath()}
+	url := "https://github.com/hashicorp/terraform"
+	for _, tag := range []string{"v1.9.2", "v1.10.0"} {
+		d := Downloader{user: "hashicorp", repository: "terraform", binaryName: "terraform", releaseTag: tag, dataPath: tempDir}
+		target := d.versionedPath()
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(target, []byte(tag), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := linkBinary(target, link); err != nil {
+			t.Fatal(err)
+		}
+		if err := hf.save(d, url, link, target, d.binaryName); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stdout := new(bytes.Buffer)
+	if err := useVersion(stdout, []string{"terraform", "1.9.2"}); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(link); string(b) != "v1.9.2" {
+		t.Fatalf("expected the link to point to v1.9.2, got '%s'", b)
+	}
+	if receipts := readReceipts(filepath.Dir(link)); len(receipts) != 1 || receipts[0].Tag != "v1.9.2" {
+		t.Fatalf("expected the receipt to name v1.9.2, got %+v", receipts)
+	}
+
+	stdout = new(bytes.Buffer)
+	if err := showVersions(stdout, []string{"hashicorp/terraform"}); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(stdout.String(), "\n")
+	if !strings.Contains(lines[3], "v1.10.0") || strings.Contains(lines[3], "*") || !strings.Contains(lines[4], "v1.9.2") || !strings.Contains(lines[4], "*") {
+		t.Fatalf("unexpected versions:\n%s", stdout.String())
+	}
+
+	if err := useVersion(stdout, []string{"terraform", "v2.0.0"}); err == nil {
+		t.Fatalf("expected an error for a version that isn't installed")
+	}
+}
+
+func TestCompareTags(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.10.0", "v1.9.2", 1},
+		{"v1.9.2", "1.9.2", 0},
+		{"v0.9", "v0.9.1", -1},
+		{"release-2", "release-10", -1},
+	}
+
+	for _, tt := range tests {
+		if got := compareTags(tt.a, tt.b); got != tt.want {
+			t.Fatalf("compareTags(%v, %v): expected %v, got %v", tt.a, tt.b, tt.want, got)
+		}
+	}
+}
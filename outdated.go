@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/olekukonko/tablewriter/tw"
+)
+
+type Outdated struct {
+	stdout          io.Writer
+	historyFilePath string
+	cachePath       string
+	dataPath        string
+	limits          Limits
+}
+
+// execute lists installed binaries with the latest release. The version in
+// the binary is used when it's found, so files replaced by hand are shown
+// as they are.
+func (o *Outdated) execute() error {
+	hf := HistoryFile{filename: o.historyFilePath}
+	histories, err := hf.load()
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var rows [][]string
+
+	for _, history := range histories {
+		// Only the version in use of a versioned install is checked.
+		if len(history.Target) != 0 && !history.isActive() {
+			continue
+		}
+
+		wg.Add(1)
+		go func(h *History) {
+			defer wg.Done()
+
+			row := o.check(h)
+			mu.Lock()
+			rows = append(rows, row)
+			mu.Unlock()
+		}(history)
+	}
+	wg.Wait()
+
+	sort.Slice(rows, func(i, j int) bool { return rows[i][0] < rows[j][0] })
+
+	table := tablewriter.NewTable(o.stdout, tablewriter.WithSymbols(tw.NewSymbols(tw.StyleASCII)))
+	table.Header("PATH", "TAG", "BINARY", "LATEST", "STATUS")
+	for _, row := range rows {
+		if err := table.Append(row); err != nil {
+			return err
+		}
+	}
+	return table.Render()
+}
+
+func (o *Outdated) check(h *History) []string {
+	v, mismatch := h.versionMismatch()
+
+	d := historyDownloader(h, o.cachePath, o.dataPath, o.limits)
+	if _, err := d.fetchRelease(); err != nil {
+		return []string{h.Path, h.Tag, v.version, "", "error: " + err.Error()}
+	}
+	latest := d.releaseTag
+
+	current := h.Tag
+	if len(v.version) != 0 {
+		current = v.version
+	}
+
+	var status []string
+	if mismatch {
+		status = append(status, "drifted")
+	}
+	if current == latest || tagMatchesVersion(latest, current) {
+		status = append(status, "up to date")
+	} else {
+		status = append(status, "outdated")
+	}
+
+	return []string{h.Path, h.Tag, v.version, latest, strings.Join(status, ", ")}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	endian "encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/h2non/filetype"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+const (
+	arMagic      = "!<arch>\n"
+	rpmLeadSize  = 96
+	cpioTrailer  = "TRAILER!!!"
+	cpioTypeMask = 0170000
+	cpioRegular  = 0100000
+	cpioSymlink  = 0120000
+)
+
+var (
+	rpmLeadMagic   = []byte{0xed, 0xab, 0xee, 0xdb}
+	rpmHeaderMagic = []byte{0x8e, 0xad, 0xe8, 0x01}
+	packageBinDirs = []string{"usr/bin", "usr/local/bin", "bin", "usr/sbin", "sbin"}
+)
+
+// isPackagedBinary reports whether a .deb or .rpm entry is the binary
+// installed to one of the bin directories, e.g. "./usr/bin/<binaryName>".
+func (d *Downloader) isPackagedBinary(name string) bool {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	for _, dir := range packageBinDirs {
+		if dir+"/"+d.binaryName == name || dir+"/"+d.executableName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Downloader) downloadDeb(body *io.ReadCloser, file string) error {
+	br := bufio.NewReader(*body)
+	magic := make([]byte, len(arMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != arMagic {
+		return errors.New("invalid deb package: missing ar header")
+	}
+
+	for {
+		hdr := make([]byte, 60)
+		if _, err := io.ReadFull(br, hdr); err != nil {
+			if err == io.EOF {
+				return errors.New("invalid deb package: data.tar is not found")
+			}
+			return err
+		}
+
+		name := strings.TrimSuffix(strings.TrimSpace(string(hdr[0:16])), "/")
+		size, err := strconv.ParseInt(strings.TrimSpace(string(hdr[48:58])), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid deb package: %v", err)
+		}
+
+		if strings.HasPrefix(name, "data.tar") {
+			r, err := d.decompress(io.LimitReader(br, size))
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+			return d.extractTarMatching(r, file, d.isPackagedBinary)
+		}
+
+		if _, err := io.CopyN(io.Discard, br, size+size%2); err != nil {
+			return err
+		}
+	}
+}
+
+func (d *Downloader) downloadRpm(body *io.ReadCloser, file string) error {
+	br := bufio.NewReader(*body)
+
+	lead := make([]byte, rpmLeadSize)
+	if _, err := io.ReadFull(br, lead); err != nil || !bytes.HasPrefix(lead, rpmLeadMagic) {
+		return errors.New("invalid rpm package: missing lead")
+	}
+
+	// The signature header is padded to a multiple of 8 bytes, the main
+	// header isn't.
+	n, err := skipRpmHeader(br)
+	if err != nil {
+		return err
+	}
+	if _, err := io.CopyN(io.Discard, br, int64((8-n%8)%8)); err != nil {
+		return err
+	}
+	if _, err := skipRpmHeader(br); err != nil {
+		return err
+	}
+
+	r, err := d.decompress(br)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return d.extractCpio(r, file, d.isPackagedBinary)
+}
+
+func skipRpmHeader(r io.Reader) (int, error) {
+	hdr := make([]byte, 16)
+	if _, err := io.ReadFull(r, hdr); err != nil || !bytes.HasPrefix(hdr, rpmHeaderMagic) {
+		return 0, errors.New("invalid rpm package: broken header")
+	}
+
+	entries := int(endian.BigEndian.Uint32(hdr[8:12]))
+	size := int(endian.BigEndian.Uint32(hdr[12:16]))
+	n := entries*16 + size
+	if _, err := io.CopyN(io.Discard, r, int64(n)); err != nil {
+		return 0, err
+	}
+	return len(hdr) + n, nil
+}
+
+// extractCpio reads a "newc" (070701) or "crc" (070702) cpio archive, the
+// payload format of RPM packages. Entries are selected and installed like the
+// ones of a tar archive.
+func (d *Downloader) extractCpio(r io.Reader, file string, match func(string) bool) error {
+	br := bufio.NewReader(r)
+	offset := 0
+	var entries []*archiveEntry
+	spool := &entrySpool{}
+	defer spool.remove()
+
+	// Hard links share an inode, and only the last one has the data.
+	dataByInode := map[int]string{}
+	hardlinks := map[*archiveEntry]int{}
+
+	for {
+		hdr := make([]byte, 110)
+		if _, err := io.ReadFull(br, hdr); err != nil {
+			return err
+		}
+		magic := string(hdr[0:6])
+		if magic != "070701" && magic != "070702" {
+			return errors.New("invalid cpio archive: unsupported format")
+		}
+
+		field := func(i int) (int, error) {
+			v, err := strconv.ParseUint(string(hdr[6+i*8:14+i*8]), 16, 32)
+			return int(v), err
+		}
+		inode, err0 := field(0)
+		mode, err1 := field(1)
+		nlink, err2 := field(4)
+		size, err3 := field(6)
+		nameSize, err4 := field(11)
+		if err := errors.Join(err0, err1, err2, err3, err4); err != nil {
+			return fmt.Errorf("invalid cpio archive: %v", err)
+		}
+		if err := d.countEntry(); err != nil {
+			return err
+		}
+
+		name := make([]byte, nameSize)
+		if _, err := io.ReadFull(br, name); err != nil {
+			return err
+		}
+		offset += len(hdr) + nameSize
+		if err := skipPadding(br, &offset, 4); err != nil {
+			return err
+		}
+
+		entryName := strings.TrimRight(string(name), "\x00")
+		if entryName == cpioTrailer {
+			break
+		}
+
+		data := io.LimitReader(br, int64(size))
+		e := &archiveEntry{name: cleanEntryName(entryName), mode: fs.FileMode(mode & 0777)}
+		kept := false
+		switch mode & cpioTypeMask {
+		case cpioRegular:
+			if size == 0 && nlink > 1 {
+				e.hardlink = true
+				hardlinks[e] = inode
+				kept = true
+				break
+			}
+			var err error
+			if kept, err = d.keepEntry(e, data, int64(size), match(entryName), spool); err != nil {
+				return err
+			}
+			if kept && nlink > 1 {
+				dataByInode[inode] = e.name
+			}
+		case cpioSymlink:
+			b, err := d.readEntry(entryName, data, int64(size))
+			if err != nil {
+				return err
+			}
+			e.mode |= fs.ModeSymlink
+			e.linkname = string(b)
+			kept = true
+		}
+		if kept {
+			entries = append(entries, e)
+		}
+
+		// Skip what wasn't read of the entry.
+		if _, err := io.Copy(io.Discard, data); err != nil {
+			return err
+		}
+		offset += size
+		if err := skipPadding(br, &offset, 4); err != nil {
+			return err
+		}
+	}
+
+	for e, inode := range hardlinks {
+		e.linkname = dataByInode[inode]
+	}
+
+	return d.installEntry(entries, file, match)
+}
+
+func skipPadding(r io.Reader, offset *int, align int) error {
+	pad := (align - *offset%align) % align
+	*offset += pad
+	_, err := io.CopyN(io.Discard, r, int64(pad))
+	return err
+}
+
+// decompress returns a reader of the decompressed data. The caller must close
+// it, since the zstd decoder runs goroutines until it's closed.
+func (d *Downloader) decompress(r io.Reader) (io.ReadCloser, error) {
+	dr, err := decompress(r)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{d.guardExpanded(dr), dr}, nil
+}
+
+// decompress detects the compression of r from its magic bytes. Data that
+// isn't compressed is returned as is.
+func decompress(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(262)
+
+	kind, _ := filetype.Archive(head)
+	switch kind.Extension {
+	case "gz":
+		return gzip.NewReader(br)
+	case "xz":
+		xr, err := xz.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(xr), nil
+	case "bz2":
+		return io.NopCloser(bzip2.NewReader(br)), nil
+	case "zst":
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}
+
+	// LZMA (used by old RPMs) has no magic bytes.
+	if len(head) > 0 && head[0] == 0x5d {
+		lr, err := lzma.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(lr), nil
+	}
+
+	return io.NopCloser(br), nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"strings"
+)
+
+type platform struct {
+	os   string
+	arch string
+	libc string
+}
+
+type tokenKind int
+
+const (
+	otherToken tokenKind = iota
+	osToken
+	archToken
+	libcToken
+	vendorToken
+)
+
+type platformToken struct {
+	kind  tokenKind
+	value string
+}
+
+var (
+	defaultOSAliases = map[string][]string{
+		"linux":   {"linux"},
+		"darwin":  {"darwin", "macos", "osx", "mac", "macosx"},
+		"windows": {"windows", "win", "win32", "win64", "mingw32", "msvc"},
+		"freebsd": {"freebsd"},
+		"netbsd":  {"netbsd"},
+		"openbsd": {"openbsd"},
+		"android": {"android"},
+	}
+
+	defaultArchAliases = map[string][]string{
+		"amd64":     {"amd64", "x86_64", "x86-64", "x64", "64bit", "64-bit"},
+		"386":       {"386", "i386", "i486", "i586", "i686", "x86", "ia32", "32bit", "32-bit"},
+		"arm64":     {"arm64", "aarch64", "armv8", "arm64v8"},
+		"arm":       {"arm", "armv5", "armv6", "armv6l", "armv6hf", "armv7", "armv7l", "armv7a", "armhf", "armel"},
+		"ppc64le":   {"ppc64le", "powerpc64le"},
+		"ppc64":     {"ppc64", "powerpc64"},
+		"s390x":     {"s390x"},
+		"riscv64":   {"riscv64", "riscv64gc"},
+		"mips":      {"mips"},
+		"mipsle":    {"mipsle", "mipsel"},
+		"mips64":    {"mips64"},
+		"mips64le":  {"mips64le", "mips64el"},
+		"universal": {"universal", "universal2", "all"},
+	}
+
+	defaultLibcAliases = map[string][]string{
+		"gnu":    {"gnu", "glibc", "gnueabi", "gnueabihf", "gnux32"},
+		"musl":   {"musl", "musleabi", "musleabihf"},
+		"static": {"static", "statically"},
+	}
+
+	targetTripleVendors = []string{"unknown", "pc", "apple", "w64", "none"}
+)
+
+// aliasTable maps the spellings used in asset names to GOOS, GOARCH and libc
+// names. Aliases with separators, like "x86_64", match consecutive tokens.
+type aliasTable struct {
+	aliases map[string]platformToken
+	maxLen  int
+}
+
+var aliases = newAliasTable(nil, nil)
+
+func newAliasTable(osAliases, archAliases map[string][]string) *aliasTable {
+	t := &aliasTable{aliases: map[string]platformToken{}}
+
+	for _, v := range targetTripleVendors {
+		t.aliases[v] = platformToken{kind: vendorToken, value: v}
+	}
+
+	t.register(osToken, defaultOSAliases)
+	t.register(archToken, defaultArchAliases)
+	t.register(libcToken, defaultLibcAliases)
+	t.register(osToken, osAliases)
+	t.register(archToken, archAliases)
+
+	return t
+}
+
+func (t *aliasTable) register(kind tokenKind, table map[string][]string) {
+	for canonical, names := range table {
+		for _, name := range append([]string{canonical}, names...) {
+			tokens := tokenize(name)
+			if len(tokens) == 0 {
+				continue
+			}
+
+			t.aliases[strings.Join(tokens, " ")] = platformToken{kind: kind, value: canonical}
+			if len(tokens) > t.maxLen {
+				t.maxLen = len(tokens)
+			}
+		}
+	}
+}
+
+func (t *aliasTable) resolve(name string) []platformToken {
+	tokens := tokenize(name)
+	resolved := make([]platformToken, 0, len(tokens))
+
+	for i := 0; i < len(tokens); {
+		matched := false
+		for n := min(t.maxLen, len(tokens)-i); n > 0; n-- {
+			if pt, ok := t.aliases[strings.Join(tokens[i:i+n], " ")]; ok {
+				resolved = append(resolved, pt)
+				i += n
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			resolved = append(resolved, platformToken{kind: otherToken, value: tokens[i]})
+			i++
+		}
+	}
+
+	return resolved
+}
+
+// parse returns the platform an asset name is built for. A Rust target triple
+// in the name wins over loose OS and arch tokens.
+func (t *aliasTable) parse(name string) platform {
+	tokens := t.resolve(name)
+	if p, ok := parseTargetTriple(tokens); ok {
+		return p
+	}
+
+	var p platform
+	for _, pt := range tokens {
+		switch {
+		case pt.kind == osToken && len(p.os) == 0:
+			p.os = pt.value
+		case pt.kind == archToken && len(p.arch) == 0:
+			p.arch = pt.value
+		case pt.kind == libcToken && len(p.libc) == 0:
+			p.libc = pt.value
+		}
+	}
+
+	return p
+}
+
+// canonical returns the GOOS or GOARCH name for a user supplied value such as
+// "aarch64" or "macos".
+func (t *aliasTable) canonical(kind tokenKind, value string) (string, bool) {
+	tokens := t.resolve(value)
+	if len(tokens) != 1 || tokens[0].kind != kind {
+		return "", false
+	}
+	return tokens[0].value, true
+}
+
+func (t *aliasTable) parseTargetTriple(triple string) (platform, bool) {
+	return parseTargetTriple(t.resolve(triple))
+}
+
+// parseTargetTriple looks for "<arch>-<vendor>-<os>[-<env>]" or
+// "<arch>-<os>[-<env>]", e.g. "x86_64-unknown-linux-musl".
+func parseTargetTriple(tokens []platformToken) (platform, bool) {
+	for i := 0; i+1 < len(tokens); i++ {
+		if tokens[i].kind != archToken {
+			continue
+		}
+
+		j := i + 1
+		if tokens[j].kind == vendorToken {
+			j++
+		}
+		if j >= len(tokens) || tokens[j].kind != osToken {
+			continue
+		}
+
+		p := platform{arch: tokens[i].value, os: tokens[j].value}
+		if j+1 < len(tokens) && tokens[j+1].kind == libcToken {
+			p.libc = tokens[j+1].value
+		}
+
+		return p, true
+	}
+
+	return platform{}, false
+}
+
+func tokenize(name string) []string {
+	return strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml"
+)
+
+var projectFileNames = []string{".obt.toml", ".obt-version"}
+
+// projectTool is a tool version pinned by a project file.
+type projectTool struct {
+	name string
+	repo string
+	tag  string
+}
+
+// matches reports whether the pinned tool is tool, given as the command name
+// or "owner/repository".
+func (p *projectTool) matches(tool string) bool {
+	return p.name == tool || p.repo == tool || strings.HasSuffix(p.repo, "/"+tool)
+}
+
+// url returns the GitHub URL of the tool, or "" when only a name is pinned.
+func (p *projectTool) url() string {
+	switch {
+	case len(p.repo) == 0:
+		return ""
+	case strings.Contains(p.repo, "://"):
+		return p.repo
+	}
+	return "https://github.com/" + p.repo
+}
+
+// findProjectFile walks up from dir and returns the nearest project file.
+func findProjectFile(dir string) (string, bool) {
+	for {
+		for _, name := range projectFileNames {
+			file := filepath.Join(dir, name)
+			if fi, err := os.Stat(file); err == nil && !fi.IsDir() {
+				return file, true
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+func loadProjectFile(file string) ([]*projectTool, error) {
+	if filepath.Base(file) == ".obt.toml" {
+		return parseProjectToml(file)
+	}
+	return parseProjectVersions(file)
+}
+
+// parseProjectVersions reads ".obt-version" with a "<tool> <tag>" per line.
+// The tool is a command name, "owner/repository" or a GitHub URL.
+func parseProjectVersions(file string) ([]*projectTool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var tools []*projectTool
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		switch len(fields) {
+		case 0:
+			continue
+		case 2:
+			tools = append(tools, newProjectTool(fields[0], "", fields[1]))
+		default:
+			return nil, fmt.Errorf("%s:%d: expected '<tool> <tag>'", file, n)
+		}
+	}
+
+	return tools, scanner.Err()
+}
+
+// parseProjectToml reads ".obt.toml". A tool is either pinned to a tag or a
+// table with the repository and the tag:
+//
+//	[tools]
+//	"hashicorp/terraform" = "v1.9.2"
+//	helm = { repo = "helm/helm", tag = "v3.14.0" }
+func parseProjectToml(file string) ([]*projectTool, error) {
+	tree, err := toml.LoadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	table, ok := tree.Get("tools").(*toml.Tree)
+	if !ok {
+		return nil, fmt.Errorf("%s: [tools] table is not found", file)
+	}
+
+	var tools []*projectTool
+	for _, key := range table.Keys() {
+		switch v := table.Get(key).(type) {
+		case string:
+			tools = append(tools, newProjectTool(key, "", v))
+		case *toml.Tree:
+			repo, _ := v.Get("repo").(string)
+			tag, _ := v.Get("tag").(string)
+			if len(tag) == 0 {
+				return nil, fmt.Errorf("%s: tag of '%s' is not set", file, key)
+			}
+			tools = append(tools, newProjectTool(key, repo, tag))
+		default:
+			return nil, fmt.Errorf("%s: invalid value of '%s'", file, key)
+		}
+	}
+
+	return tools, nil
+}
+
+func newProjectTool(key, repo, tag string) *projectTool {
+	if len(repo) == 0 && strings.Contains(key, "/") {
+		repo = strings.TrimSuffix(key, "/")
+	}
+
+	name := key
+	if len(repo) != 0 {
+		_, _, r, ok := parseRepositoryURL(repo)
+		if ok && strings.Contains(key, "/") {
+			name = r
+		}
+	}
+
+	return &projectTool{name: name, repo: repo, tag: tag}
+}
+
+// pinnedVersion returns the version of tool pinned by the project file
+// nearest to dir.
+func pinnedVersion(dir, tool string) (*projectTool, string, error) {
+	file, ok := findProjectFile(dir)
+	if !ok {
+		return nil, "", nil
+	}
+
+	tools, err := loadProjectFile(file)
+	if err != nil {
+		return nil, file, err
+	}
+
+	for _, t := range tools {
+		if t.matches(tool) {
+			return t, file, nil
+		}
+	}
+	return nil, file, nil
+}
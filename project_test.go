@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestProjectFile(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := findProjectFile(sub); ok {
+		t.Fatalf("expected no project file")
+	}
+
+	versions := "# pinned tools\nhashicorp/terraform v1.9.2\nhelm 3.14.0\n"
+	if err := os.WriteFile(filepath.Join(root, ".obt-version"), []byte(versions), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := "[tools]\n\"hashicorp/terraform\" = \"v1.5.7\"\nhelm = { repo = \"helm/helm\", tag = \"v3.13.0\" }\n"
+	if err := os.WriteFile(filepath.Join(root, "a", ".obt.toml"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		dir  string
+		tool string
+		repo string
+		tag  string
+	}{
+		{root, "terraform", "hashicorp/terraform", "v1.9.2"},
+		{root, "helm", "", "3.14.0"},
+		{sub, "terraform", "hashicorp/terraform", "v1.5.7"},
+		{sub, "helm", "helm/helm", "v3.13.0"},
+		{sub, "hashicorp/terraform", "hashicorp/terraform", "v1.5.7"},
+	}
+
+	for _, tt := range tests {
+		p, _, err := pinnedVersion(tt.dir, tt.tool)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p == nil || p.repo != tt.repo || p.tag != tt.tag {
+			t.Fatalf("dir: '%v', tool: '%v', expected %v %v, got %+v", tt.dir, tt.tool, tt.repo, tt.tag, p)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(root, ".obt-version"), []byte("terraform\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := pinnedVersion(root, "terraform"); err == nil {
+		t.Fatalf("expected an error for a line without a tag")
+	}
+}
+
+func TestShim(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shims are batch files on Windows")
+	}
+
+	tempDir := t.TempDir()
+	orig, origPath := cfg, tmpInstallPath
+	defer func() { cfg, tmpInstallPath = orig, origPath }()
+	cfg.HistoryFilePath = tempDir
+	tmpInstallPath = tempDir
+
+	stdout := new(bytes.Buffer)
+	if err := writeShims(stdout, []string{"hashicorp/terraform"}); err != nil {
+		t.Fatal(err)
+	}
+	shim := filepath.Join(tempDir, "terraform")
+	if !isShim(shim) {
+		t.Fatalf("'%s' isn't a shim", shim)
+	}
+
+	if err := os.WriteFile(filepath.Join(tempDir, "helm"), []byte("binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeShims(stdout, []string{"helm"}); err == nil {
+		t.Fatalf("expected an error for an existing binary")
+	}
+
+	hf := HistoryFile{filename: determineHistoryFilePath()}
+	for _, tag := range []string{"v1.9.2", "v1.10.0"} {
+		d := Downloader{user: "hashicorp", repository: "terraform", binaryName: "terraform", releaseTag: tag, dataPath: tempDir}
+		target := d.versionedPath()
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(target, []byte("#!/bin/sh\necho "+tag+" \"$@\"\nexit 3\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := hf.save(d, "https://github.com/hashicorp/terraform", shim, target, d.binaryName); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	project := filepath.Join(tempDir, "project")
+	if err := os.MkdirAll(project, 0755); err != nil {
+		t.Fatal(err)
+	}
+	origDir, _ := os.Getwd()
+	defer os.Chdir(origDir)
+	os.Chdir(project)
+
+	tests := []struct {
+		pinned string
+		want   string
+	}{
+		{"", "v1.10.0 plan\n"},
+		{"terraform 1.9.2\n", "v1.9.2 plan\n"},
+	}
+
+	for _, tt := range tests {
+		if len(tt.pinned) > 0 {
+			if err := os.WriteFile(filepath.Join(project, ".obt-version"), []byte(tt.pinned), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+		code := execTool(stdout, stderr, []string{"terraform", "plan"})
+		if code != 3 || stdout.String() != tt.want {
+			t.Fatalf("pinned: '%v', expected '%v' with 3, got '%v' with %v (%v)", tt.pinned, tt.want, stdout.String(), code, stderr.String())
+		}
+	}
+}
+
+func TestShimKeepsVersionInUse(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shims are batch files on Windows")
+	}
+
+	tempDir := t.TempDir()
+	orig, origPath := cfg, tmpInstallPath
+	defer func() { cfg, tmpInstallPath = orig, origPath }()
+	cfg.HistoryFilePath = tempDir
+	tmpInstallPath = tempDir
+
+	link := filepath.Join(tempDir, "terraform")
+	hf := HistoryFile{filename: determineHistoryFilePath()}
+	var versions []*History
+	for _, tag := range []string{"v1.9.2", "v1.10.0"} {
+		d := Downloader{user: "hashicorp", repository: "terraform", binaryName: "terraform", releaseTag: tag, dataPath: tempDir}
+		target := d.versionedPath()
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(target, []byte(tag), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := hf.save(d, "https://github.com/hashicorp/terraform", link, target, d.binaryName); err != nil {
+			t.Fatal(err)
+		}
+		versions = append(versions, &History{Path: link, Target: target, Tag: tag})
+	}
+	if err := linkBinary(versions[0].Target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := new(bytes.Buffer)
+	if err := writeShims(stdout, []string{"terraform"}); err != nil {
+		t.Fatal(err)
+	}
+	if !isShim(link) || !versions[0].isActive() || versions[1].isActive() {
+		t.Fatalf("expected the shim to keep v1.9.2 in use")
+	}
+
+	if err := useVersion(stdout, []string{"terraform", "v1.10.0"}); err != nil {
+		t.Fatal(err)
+	}
+	if !isShim(link) || versions[0].isActive() || !versions[1].isActive() {
+		t.Fatalf("expected the shim to use v1.10.0")
+	}
+}
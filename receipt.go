@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// receiptDir is the directory in an install path that keeps a receipt
+	// for each binary installed there.
+	receiptDir     = ".obt"
+	receiptVersion = 1
+)
+
+// receipt records an install next to the binary, so the history can be
+// rebuilt from the install paths alone.
+type receipt struct {
+	Version int     `json:"version"`
+	History History `json:"history"`
+}
+
+func receiptPath(file string) string {
+	return filepath.Join(filepath.Dir(file), receiptDir, filepath.Base(file)+".json")
+}
+
+// writeReceipt writes the receipt of h when the binary is installed. The
+// path isn't recorded, since it's given by where the receipt is.
+func writeReceipt(h *History) error {
+	if _, err := os.Lstat(h.Path); err != nil {
+		return nil
+	}
+
+	r := receipt{Version: receiptVersion, History: *h}
+	r.History.Path = ""
+
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file := receiptPath(h.Path)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(b, '\n'), 0644)
+}
+
+func removeReceipt(h *History) error {
+	err := os.Remove(receiptPath(h.Path))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// readReceipts returns the histories of the receipts in dir. Receipts of
+// binaries that don't exist anymore and broken receipts are ignored.
+func readReceipts(dir string) []*History {
+	entries, err := os.ReadDir(filepath.Join(dir, receiptDir))
+	if err != nil {
+		return nil
+	}
+
+	var histories []*History
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+
+		file := filepath.Join(dir, strings.TrimSuffix(e.Name(), ".json"))
+		if _, err := os.Lstat(file); err != nil {
+			continue
+		}
+
+		b, err := os.ReadFile(filepath.Join(dir, receiptDir, e.Name()))
+		if err != nil {
+			continue
+		}
+		var r receipt
+		if err := json.Unmarshal(b, &r); err != nil || r.Version > receiptVersion {
+			continue
+		}
+
+		h := r.History
+		h.Path = file
+		histories = append(histories, &h)
+	}
+
+	return histories
+}
+
+// mergeReceipts adds the receipts in dirs to histories. A receipt replaces
+// an entry only when it's newer. It returns the number of merged receipts.
+func mergeReceipts(histories map[string]*History, dirs []string) int {
+	merged := 0
+	for _, dir := range dirs {
+		for _, h := range readReceipts(dir) {
+			if prev, ok := histories[h.key()]; ok && !h.UpdatedAt.After(prev.UpdatedAt) {
+				continue
+			}
+			histories[h.key()] = h
+			merged++
+		}
+	}
+	return merged
+}
+
+// receiptDirs returns the install path and "bin_dirs" in the config.
+func receiptDirs() []string {
+	var dirs []string
+	seen := map[string]bool{}
+	for _, dir := range append([]string{cfg.Path}, cfg.BinDirs...) {
+		if len(dir) == 0 || seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/y-yagi/goext/osext"
+)
+
+func TestReceipts(t *testing.T) {
+	tempDir := t.TempDir()
+	bin := filepath.Join(tempDir, "bin")
+	if err := os.MkdirAll(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	tool := filepath.Join(bin, "tool")
+	if err := os.WriteFile(tool, []byte("tool"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	hf := HistoryFile{filename: filepath.Join(tempDir, "history")}
+	d := Downloader{releaseTag: "v1.0.0", assetName: "tool_linux_amd64.tar.gz"}
+	if err := hf.save(d, "https://github.com/owner/tool", tool, "", "tool"); err != nil {
+		t.Fatal(err)
+	}
+	if !osext.IsExist(receiptPath(tool)) {
+		t.Fatalf("expected a receipt at '%s'", receiptPath(tool))
+	}
+
+	receipts := readReceipts(bin)
+	if len(receipts) != 1 || receipts[0].Path != tool || receipts[0].Tag != "v1.0.0" || receipts[0].AssetName != d.assetName || len(receipts[0].SHA256) == 0 {
+		t.Fatalf("unexpected receipts %+v", receipts)
+	}
+
+	// Receipts are merged into a history that doesn't have them.
+	if err := os.Remove(hf.filename); err != nil {
+		t.Fatal(err)
+	}
+	stdout := new(bytes.Buffer)
+	if err := scanReceipts(stdout, hf, []string{bin}); err != nil {
+		t.Fatal(err)
+	}
+	histories, err := hf.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := histories[tool]; h == nil || h.AssetName != d.assetName || !strings.HasPrefix(stdout.String(), "Merge 1 receipts") {
+		t.Fatalf("unexpected histories %+v: %s", histories, stdout)
+	}
+
+	// An entry newer than the receipt is kept.
+	histories[tool].UpdatedAt = histories[tool].UpdatedAt.Add(time.Hour)
+	histories[tool].Tag = "v1.1.0"
+	if n := mergeReceipts(histories, []string{bin}); n != 0 || histories[tool].Tag != "v1.1.0" {
+		t.Fatalf("expected the newer entry to be kept, got %d merged, %+v", n, histories[tool])
+	}
+
+	// Repair rebuilds the history from receipts.
+	if err := os.WriteFile(hf.filename, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= maxHistoryBackups; i++ {
+		os.Remove(hf.backupName(i))
+	}
+	if err := repairHistory(stdout, hf, []string{bin}, ""); err != nil {
+		t.Fatal(err)
+	}
+	histories, err = hf.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := histories[tool]; len(histories) != 1 || h == nil || h.URL != "https://github.com/owner/tool" || h.Tag != "v1.0.0" || h.AssetName != d.assetName {
+		t.Fatalf("unexpected rebuilt histories %+v", histories)
+	}
+
+	// Receipts of removed binaries are ignored.
+	if err := os.Remove(tool); err != nil {
+		t.Fatal(err)
+	}
+	if receipts := readReceipts(bin); len(receipts) != 0 {
+		t.Fatalf("expected no receipts, got %+v", receipts)
+	}
+}
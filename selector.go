@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+type assetCandidate struct {
+	name     string
+	url      string
+	size     int
+	score    int
+	rejected bool
+	portable bool
+	reasons  []string
+}
+
+var (
+	nonBinarySuffixes = []string{".sig", ".pem", ".txt", ".json", ".sbom", ".sha256", ".sha512", ".sha1", ".md5", ".asc", ".crt", ".spdx", ".md", ".pub", ".intoto.jsonl", ".zsync", "checksums"}
+)
+
+func (c *assetCandidate) add(score int, format string, a ...interface{}) {
+	c.score += score
+	c.reasons = append(c.reasons, fmt.Sprintf("%+d ", score)+fmt.Sprintf(format, a...))
+}
+
+func (c *assetCandidate) reject(format string, a ...interface{}) {
+	c.rejected = true
+	c.reasons = append(c.reasons, "rejected: "+fmt.Sprintf(format, a...))
+}
+
+func (d *Downloader) rankAssets(assets []github.ReleaseAsset) []*assetCandidate {
+	candidates := make([]*assetCandidate, 0, len(assets))
+	for _, asset := range assets {
+		c := d.scoreAsset(asset.GetName())
+		c.url = asset.GetBrowserDownloadURL()
+		c.size = asset.GetSize()
+		candidates = append(candidates, c)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].rejected != candidates[j].rejected {
+			return !candidates[i].rejected
+		}
+		return candidates[i].score > candidates[j].score
+	})
+
+	return candidates
+}
+
+func (d *Downloader) scoreAsset(assetName string) *assetCandidate {
+	c := &assetCandidate{name: assetName}
+	lowerName := strings.ToLower(assetName)
+
+	if !d.isSupportedFormat(lowerName) {
+		c.reject("unsupported package format")
+		return c
+	}
+
+	for _, suffix := range nonBinarySuffixes {
+		if strings.HasSuffix(lowerName, suffix) {
+			c.reject("'%s' is not a binary", suffix)
+			return c
+		}
+	}
+
+	p := aliases.parse(assetName)
+	tokens := tokenize(assetName)
+	fType := fileTypeFromName(lowerName)
+
+	if len(p.os) == 0 && (fType == debType || fType == rpmType || fType == appImageType) {
+		p.os = "linux"
+	}
+	if len(p.arch) == 0 && fType == appImageType {
+		// AppImages without an architecture in the name are x86_64 only.
+		p.arch = "amd64"
+	}
+
+	if len(p.os) == 0 && len(p.arch) == 0 && len(p.libc) == 0 && fType == binary {
+		// A single file without platform markers, e.g. a shell script.
+		c.portable = true
+		c.add(0, "no platform markers")
+		c.scoreName(d.binaryName)
+		if c.score <= 0 {
+			c.reject("name doesn't match '%s'", d.binaryName)
+		}
+		return c
+	}
+
+	switch {
+	case p.os == d.targetOS():
+		c.add(30, "os '%s' matches", p.os)
+	case len(p.os) != 0:
+		c.reject("built for os '%s'", p.os)
+		return c
+	default:
+		c.reject("no os in name")
+		return c
+	}
+
+	switch {
+	case p.arch == d.targetArch():
+		c.add(20, "arch '%s' matches", p.arch)
+	case p.arch == "universal" && d.targetOS() == "darwin":
+		c.add(15, "universal binary")
+	case len(p.arch) != 0:
+		c.reject("built for arch '%s'", p.arch)
+		return c
+	default:
+		c.reject("no arch in name")
+		return c
+	}
+
+	if d.targetOS() == "linux" && len(d.libc) != 0 {
+		switch {
+		case p.libc == d.libc:
+			c.add(6, "libc '%s' matches", p.libc)
+		case p.libc == "static":
+			c.add(5, "static build")
+		case p.libc == "gnu" && d.libc == "musl":
+			c.reject("glibc build on a musl system")
+			return c
+		case p.libc == "musl":
+			c.add(4, "musl build")
+		case len(p.libc) == 0 && d.libc == "gnu":
+			c.add(5, "default build")
+		}
+	}
+
+	if hasToken(tokens, "debug") || hasToken(tokens, "dbg") {
+		c.add(-50, "debug build")
+	}
+
+	switch fType {
+	case tarGzType, tarXzType, tarBz2Type, tarZstType:
+		c.add(3, "tar archive")
+	case zipType:
+		c.add(2, "zip archive")
+	case sevenZipType:
+		c.add(1, "7z archive")
+	case gzipType, xzType, bz2Type, zstType:
+		c.add(1, "compressed binary")
+	case debType, rpmType:
+		c.add(-5, "Linux package")
+	case appImageType:
+		c.add(-2, "AppImage")
+	}
+
+	c.scoreName(d.binaryName)
+	return c
+}
+
+func (c *assetCandidate) scoreName(binaryName string) {
+	name := normalizeName(c.name)
+	prefix := normalizeName(binaryName)
+
+	switch {
+	case len(prefix) == 0:
+	case strings.HasPrefix(name, prefix+"_"):
+		c.add(10, "name starts with '%s'", binaryName)
+	case strings.HasPrefix(name, prefix):
+		c.add(6, "name begins with '%s'", binaryName)
+	case strings.Contains(name, prefix):
+		c.add(4, "name contains '%s'", binaryName)
+	default:
+		c.add(0, "name doesn't mention '%s'", binaryName)
+	}
+}
+
+func normalizeName(name string) string {
+	return strings.ToLower(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+}
+
+func findToken(tokens, values []string) string {
+	for _, t := range tokens {
+		for _, v := range values {
+			if t == v {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+func hasToken(tokens []string, value string) bool {
+	return findToken(tokens, []string{value}) != ""
+}
+
+func fileTypeFromName(name string) fileType {
+	switch {
+	case strings.HasSuffix(name, "tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return tarGzType
+	case strings.HasSuffix(name, "gzip"):
+		return gzipType
+	case strings.HasSuffix(name, "zip"):
+		return zipType
+	case strings.HasSuffix(name, "tar.xz"), strings.HasSuffix(name, ".txz"):
+		return tarXzType
+	case strings.HasSuffix(name, "xz"):
+		return xzType
+	case strings.HasSuffix(name, "gz"):
+		return gzipType
+	case strings.HasSuffix(name, "tar.bz2"), strings.HasSuffix(name, ".tbz2"), strings.HasSuffix(name, ".tbz"):
+		return tarBz2Type
+	case strings.HasSuffix(name, "bz2"):
+		return bz2Type
+	case strings.HasSuffix(name, "tar.zst"), strings.HasSuffix(name, ".tzst"):
+		return tarZstType
+	case strings.HasSuffix(name, "zst"):
+		return zstType
+	case strings.HasSuffix(name, ".7z"):
+		return sevenZipType
+	case strings.HasSuffix(name, ".deb"):
+		return debType
+	case strings.HasSuffix(name, ".rpm"):
+		return rpmType
+	case strings.HasSuffix(name, ".appimage"):
+		return appImageType
+	}
+	return binary
+}
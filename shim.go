@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/y-yagi/goext/osext"
+)
+
+const shimMarker = "obt shim"
+
+func shimPath(dir, tool string) string {
+	file := filepath.Join(dir, tool)
+	if runtime.GOOS == "windows" {
+		return file + ".cmd"
+	}
+	return file
+}
+
+// shimScript runs "obt exec <tool>", which picks the version of the current
+// project.
+func shimScript(obt, tool string) string {
+	if runtime.GOOS == "windows" {
+		return fmt.Sprintf("@REM %s\r\n@\"%s\" exec %s %%*\r\n", shimMarker, obt, tool)
+	}
+
+	quote := func(s string) string { return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'" }
+	return fmt.Sprintf("#!/bin/sh\n# %s: runs the version of '%s' pinned by .obt-version or .obt.toml.\nexec %s exec %s \"$@\"\n", shimMarker, tool, quote(obt), quote(tool))
+}
+
+func isShim(file string) bool {
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	// The marker is in the first lines, so binaries aren't read entirely.
+	head := make([]byte, 256)
+	n, _ := io.ReadFull(f, head)
+	return bytes.Contains(head[:n], []byte(shimMarker))
+}
+
+// activeVersionPath returns the file that records the version a shim runs
+// when no version is pinned.
+func activeVersionPath(shim string) string {
+	return filepath.Join(filepath.Dir(shim), receiptDir, filepath.Base(shim)+".active")
+}
+
+func readActiveVersion(shim string) string {
+	b, err := os.ReadFile(activeVersionPath(shim))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func writeActiveVersion(shim, target string) error {
+	file := activeVersionPath(shim)
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, []byte(target+"\n"), 0644)
+}
+
+func writeShims(stdout io.Writer, args []string) error {
+	if len(args) == 0 {
+		return errors.New("please specify tools. Usage: obt shim <tool>...")
+	}
+
+	dir, err := determinePath()
+	if err != nil {
+		return err
+	}
+
+	obt, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	for _, tool := range args {
+		tool = path.Base(strings.TrimSuffix(tool, "/"))
+		file := shimPath(dir, tool)
+
+		if osext.IsExist(file) || isSymlink(file) {
+			if !isSymlink(file) && !isShim(file) {
+				return fmt.Errorf("'%s' exists and isn't a shim. Please remove it first", file)
+			}
+			// Keep the version in use of a versioned install.
+			if dest, err := os.Readlink(file); err == nil {
+				if err := writeActiveVersion(file, dest); err != nil {
+					return err
+				}
+			}
+			if err := os.Remove(file); err != nil {
+				return err
+			}
+		}
+
+		if err := os.WriteFile(file, []byte(shimScript(obt, tool)), 0755); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Create a shim '%s'.\n", file)
+	}
+
+	return nil
+}
+
+// execTool runs the version of tool pinned for the current directory and
+// returns its exit code.
+func execTool(stdout, stderr io.Writer, args []string) int {
+	if len(args) == 0 {
+		return msg(errors.New("please specify a tool. Usage: obt exec <tool> [ARGS]"), stderr)
+	}
+
+	file, err := resolveTool(stderr, args[0])
+	if err != nil {
+		return msg(err, stderr)
+	}
+
+	c := exec.Command(file, args[1:]...)
+	c.Stdin = os.Stdin
+	c.Stdout = stdout
+	c.Stderr = stderr
+	if err := c.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		return msg(err, stderr)
+	}
+	return 0
+}
+
+// resolveTool returns the binary of tool to run. Without a pinned version,
+// the version in use or the newest installed one is used. A pinned version
+// that isn't installed yet is installed with the versioned layout.
+func resolveTool(stderr io.Writer, tool string) (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	pinned, projectFile, err := pinnedVersion(dir, tool)
+	if err != nil {
+		return "", err
+	}
+
+	hf := HistoryFile{filename: determineHistoryFilePath()}
+	histories, err := hf.load()
+	if err != nil {
+		histories = map[string]*History{}
+	}
+
+	var installed []*History
+	var known *History
+	for _, h := range histories {
+		if !h.matchTool(tool) {
+			continue
+		}
+		known = h
+		if len(h.Target) != 0 && osext.IsExist(h.Target) {
+			installed = append(installed, h)
+		}
+	}
+	sortVersions(installed)
+
+	if pinned == nil {
+		for _, h := range installed {
+			if h.isActive() {
+				return h.Target, nil
+			}
+		}
+		if len(installed) > 0 {
+			return installed[0].Target, nil
+		}
+		return "", fmt.Errorf("no version of '%s' is pinned in .obt-version or .obt.toml, and none is installed", tool)
+	}
+
+	for _, h := range installed {
+		if h.Tag == pinned.tag || h.Tag == "v"+pinned.tag {
+			return h.Target, nil
+		}
+	}
+
+	url, binaryName := pinned.url(), ""
+	if known != nil {
+		if len(url) == 0 {
+			url = known.URL
+		}
+		binaryName = known.BinaryName
+	}
+	if len(url) == 0 {
+		return "", fmt.Errorf("the repository of '%s' is unknown. Please write it as 'owner/repo' in '%s'", tool, projectFile)
+	}
+
+	return installVersion(stderr, url, pinned.tag, binaryName, tool)
+}
+
+func installVersion(stderr io.Writer, url, tag, binaryName, tool string) (string, error) {
+	_, user, repository, ok := parseRepositoryURL(url)
+	if !ok {
+		return "", fmt.Errorf("invalid repository URL '%s'", url)
+	}
+
+	d, err := newDownloader(user, repository)
+	if err != nil {
+		return "", err
+	}
+	if len(binaryName) != 0 {
+		d.binaryName = binaryName
+	}
+	d.stderr = stderr
+
+	if len(d.dataPath) == 0 {
+		return "", errors.New("can't determine the data directory. Please set 'data_path' in the config")
+	}
+
+	d.releaseTag = tag
+	err = d.findDownloadURL()
+	if err != nil && !strings.HasPrefix(tag, "v") {
+		d.releaseTag = "v" + tag
+		err = d.findDownloadURL()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	target := d.versionedPath()
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return "", err
+	}
+	if err := d.execute(target); err != nil {
+		return "", err
+	}
+	fmt.Fprintf(stderr, "Download '%s(%s)' to '%s'.\n", d.binaryName, d.releaseTag, target)
+
+	link := target
+	if dir, err := determinePath(); err == nil {
+		link = shimPath(dir, tool)
+	}
+
+	hf := HistoryFile{filename: determineHistoryFilePath()}
+	if err := hf.save(d, url, link, target, d.binaryName); err != nil {
+		fmt.Fprintf(stderr, "history save error %v\n", err)
+	}
+
+	return target, nil
+}
@@ -3,8 +3,12 @@ package main
 import (
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+
+	"github.com/y-yagi/goext/osext"
 )
 
 type Updater struct {
@@ -12,6 +16,9 @@ type Updater struct {
 	stderr          io.Writer
 	historyFilePath string
 	cachePath       string
+	dataPath        string
+	limits          Limits
+	skipMissing     bool
 }
 
 func (u *Updater) execute() error {
@@ -23,13 +30,27 @@ func (u *Updater) execute() error {
 
 	var wg sync.WaitGroup
 	var mu sync.Mutex
+	var updated []*History
+	var skipped []string
 
 	for _, history := range histories {
 		go func(h *History) {
 			defer wg.Done()
 
-			parsedURL := strings.Split(h.URL, "/")
-			downloader := Downloader{user: parsedURL[len(parsedURL)-2], repository: parsedURL[len(parsedURL)-1], binaryName: h.BinaryName, cachePath: u.cachePath, releaseTag: ""}
+			// Only the version in use is updated, others are kept as they are.
+			if len(h.Target) != 0 && !h.isActive() {
+				return
+			}
+
+			if u.skipMissing && !osext.IsExist(h.installedFile()) {
+				mu.Lock()
+				fmt.Fprintf(u.stderr, "Skip '%v', the file is missing\n", h.installedFile())
+				skipped = append(skipped, h.installedFile())
+				mu.Unlock()
+				return
+			}
+
+			downloader := historyDownloader(h, u.cachePath, u.dataPath, u.limits)
 
 			err := downloader.findDownloadURL()
 			if err != nil {
@@ -46,7 +67,17 @@ func (u *Updater) execute() error {
 				return
 			}
 
-			err = downloader.execute(h.Path)
+			target := h.Path
+			if len(h.Target) != 0 {
+				target = downloader.versionedPath()
+				err = os.MkdirAll(filepath.Dir(target), 0755)
+			}
+			if err == nil {
+				err = downloader.execute(target)
+			}
+			if err == nil && len(h.Target) != 0 {
+				err = activateVersion(target, h.Path)
+			}
 			if err != nil {
 				mu.Lock()
 				fmt.Fprintf(u.stderr, "An error occurred while updating '%v', '%v'\n", h.Path, err)
@@ -56,13 +87,54 @@ func (u *Updater) execute() error {
 
 			mu.Lock()
 			fmt.Fprintf(u.stdout, "Updated '%v' from '%v' to '%v'\n", h.Path, h.Tag, downloader.releaseTag)
-			// TODO: Run save just once.
-			hf.save(downloader, h.URL, h.Path, h.BinaryName)
+			if downloader.info != nil && downloader.info.format == "script" {
+				fmt.Fprintf(u.stderr, "warning: '%v' is a script, not a binary. It runs with '%v'.\n", h.Path, downloader.info.interpreter)
+			}
+			if len(downloader.missing) > 0 {
+				fmt.Fprintf(u.stderr, "warning: '%v' needs shared libraries that can't be found: %v.%v\n", h.Path, strings.Join(downloader.missing, ", "), downloader.alternativeAssetHint())
+			}
+			if len(h.Target) == 0 {
+				target = ""
+			}
+			updated = append(updated, newHistory(downloader, h.URL, h.Path, target, h.BinaryName))
 			mu.Unlock()
 		}(history)
 		wg.Add(1)
 	}
 
 	wg.Wait()
+
+	if len(skipped) > 0 {
+		fmt.Fprintf(u.stderr, "Skipped %d missing binaries. Remove them from the history with 'obt history prune'.\n", len(skipped))
+	}
+
+	if len(updated) == 0 {
+		return nil
+	}
+
+	// Histories are written once. Entries changed by other processes in the
+	// meantime are kept.
+	err = hf.update(func(histories map[string]*History) error {
+		for _, h := range updated {
+			putHistory(histories, h)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, h := range updated {
+		if err := writeReceipt(h); err != nil {
+			fmt.Fprintf(u.stderr, "receipt save error %v\n", err)
+		}
+	}
 	return nil
 }
+
+// historyDownloader returns a Downloader that installs the latest release
+// of h with the same options.
+func historyDownloader(h *History, cachePath, dataPath string, limits Limits) Downloader {
+	parsedURL := strings.Split(h.URL, "/")
+	return Downloader{user: parsedURL[len(parsedURL)-2], repository: parsedURL[len(parsedURL)-1], binaryName: h.BinaryName, outputName: h.OutputName, cachePath: cachePath, releaseTag: "", goos: h.OS, goarch: h.Arch, libc: h.Libc, dataPath: dataPath, appImage: h.AppImage, allowScript: h.AllowScript, pathInArchive: h.PathInArchive, limits: limits}
+}
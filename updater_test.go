@@ -0,0 +1,26 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdaterSkipMissing(t *testing.T) {
+	tempDir := t.TempDir()
+	hf := HistoryFile{filename: filepath.Join(tempDir, "history")}
+	if err := hf.save(Downloader{releaseTag: "v1.0.0"}, "https://github.com/owner/tool", filepath.Join(tempDir, "tool"), "", "tool"); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	u := Updater{stdout: stdout, stderr: stderr, historyFilePath: hf.filename, skipMissing: true}
+	if err := u.execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Skip '" + filepath.Join(tempDir, "tool") + "', the file is missing\nSkipped 1 missing binaries. Remove them from the history with 'obt history prune'.\n"
+	if stderr.String() != want {
+		t.Fatalf("expected '%s', got '%s'", want, stderr)
+	}
+}
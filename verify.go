@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/olekukonko/tablewriter/tw"
+	"github.com/y-yagi/goext/osext"
+)
+
+const (
+	statusOK          = "OK"
+	statusFixed       = "FIXED"
+	statusModified    = "MODIFIED"
+	statusMissing     = "MISSING"
+	statusPermissions = "PERMISSIONS"
+	statusUnverified  = "UNVERIFIED"
+	statusVersion     = "VERSION"
+)
+
+type Verifier struct {
+	stdout          io.Writer
+	stderr          io.Writer
+	historyFilePath string
+	cachePath       string
+	dataPath        string
+	limits          Limits
+	fix             bool
+}
+
+// execute checks every installed binary against the history and returns an
+// error when any of them doesn't match.
+func (v *Verifier) execute() error {
+	hf := HistoryFile{filename: v.historyFilePath}
+	histories, err := hf.load()
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(histories))
+	for k := range histories {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	table := tablewriter.NewTable(v.stdout, tablewriter.WithSymbols(tw.NewSymbols(tw.StyleASCII)))
+	table.Header("PATH", "TAG", "STATUS", "DETAIL")
+
+	failures := 0
+	for _, k := range keys {
+		h := histories[k]
+		status, detail := checkInstall(h)
+
+		if v.fix && isMismatch(status) {
+			if err := v.fixInstall(h, status); err != nil {
+				detail = fmt.Sprintf("%s, fix failed: %v", detail, err)
+			} else if s, d := checkInstall(h); s == statusOK {
+				status, detail = statusFixed, fmt.Sprintf("was %s", status)
+			} else {
+				status, detail = s, d+" after reinstalling"
+			}
+		}
+
+		if isMismatch(status) {
+			failures++
+		}
+
+		err := table.Append([]string{h.installedFile(), h.Tag, status, detail})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := table.Render(); err != nil {
+		return err
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("%d of %d binaries don't match the history", failures, len(histories))
+	}
+	return nil
+}
+
+func isMismatch(status string) bool {
+	return status == statusModified || status == statusMissing || status == statusPermissions
+}
+
+// checkInstall compares the installed file of h with the history. The
+// version in the binary is checked too, since a file replaced by hand may
+// have no checksum recorded. When the checksum matches, the file is what obt
+// installed, so a version mismatch is only reported and isn't a failure.
+func checkInstall(h *History) (status, detail string) {
+	status, detail = checkFile(h)
+	if status == statusMissing || status == statusPermissions {
+		return status, detail
+	}
+
+	v, mismatch := h.versionMismatch()
+	if !mismatch {
+		return status, detail
+	}
+
+	msg := fmt.Sprintf("binary is %s (%s), but the history has %s", v.version, v.source, h.Tag)
+	switch status {
+	case statusModified:
+		return status, detail + ", " + msg
+	case statusUnverified:
+		return statusModified, msg
+	}
+	return statusVersion, msg
+}
+
+// checkFile compares the installed file of h with the size, SHA-256 and mode
+// recorded at install time.
+func checkFile(h *History) (status, detail string) {
+	file := h.installedFile()
+	fi, err := os.Stat(file)
+	if err != nil {
+		return statusMissing, "file doesn't exist"
+	}
+
+	if len(h.SHA256) == 0 {
+		return statusUnverified, "no checksum is recorded"
+	}
+
+	if h.Size != 0 && fi.Size() != h.Size {
+		return statusModified, fmt.Sprintf("size is %d bytes, expected %d bytes", fi.Size(), h.Size)
+	}
+
+	sum, err := sha256File(file)
+	if err != nil {
+		return statusModified, err.Error()
+	}
+	if sum != h.SHA256 {
+		return statusModified, fmt.Sprintf("SHA-256 is %s, expected %s", shortHash(sum), shortHash(h.SHA256))
+	}
+
+	if h.Mode != 0 && fi.Mode().Perm() != h.Mode {
+		return statusPermissions, fmt.Sprintf("mode is %v, expected %v", fi.Mode().Perm(), h.Mode)
+	}
+
+	return statusOK, ""
+}
+
+// fixInstall restores the mode, or installs the recorded tag again.
+func (v *Verifier) fixInstall(h *History, status string) error {
+	file := h.installedFile()
+	if status == statusPermissions {
+		return os.Chmod(file, h.Mode)
+	}
+
+	d := historyDownloader(h, v.cachePath, v.dataPath, v.limits)
+	d.releaseTag = h.Tag
+	d.stderr = v.stderr
+
+	if err := d.findDownloadURL(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	if err := d.execute(file); err != nil {
+		return err
+	}
+	if h.Mode != 0 {
+		if err := os.Chmod(file, h.Mode); err != nil {
+			return err
+		}
+	}
+
+	if len(h.Target) != 0 && !osext.IsExist(h.Path) && !isSymlink(h.Path) {
+		return linkBinary(h.Target, h.Path)
+	}
+	return nil
+}
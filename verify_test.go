@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifier(t *testing.T) {
+	tempDir := t.TempDir()
+	hf := HistoryFile{filename: filepath.Join(tempDir, "history")}
+
+	install := func(name, body string) string {
+		file := filepath.Join(tempDir, name)
+		os.Remove(file)
+		if err := os.WriteFile(file, []byte(body), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := hf.save(Downloader{releaseTag: "v1.0.0"}, "https://github.com/owner/"+name, file, "", name); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+
+	install("ok", "ok")
+	modified := install("modified", "original")
+	missing := install("missing", "missing")
+	permissions := install("permissions", "permissions")
+
+	if err := os.WriteFile(modified, []byte("tampered"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(missing); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(permissions, 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	v := Verifier{stdout: stdout, stderr: stderr, historyFilePath: hf.filename}
+	err := v.execute()
+	if err == nil || err.Error() != "3 of 4 binaries don't match the history" {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	tests := []struct {
+		file   string
+		status string
+	}{
+		{"/missing ", statusMissing},
+		{"/modified ", statusModified},
+		{"/ok ", statusOK},
+		{"/permissions ", statusPermissions},
+	}
+
+	lines := strings.Split(stdout.String(), "\n")[3:]
+	for i, tt := range tests {
+		if !strings.Contains(lines[i], tt.file) || !strings.Contains(lines[i], " "+tt.status+" ") {
+			t.Fatalf("expected '%v' to be %v, got '%v'", tt.file, tt.status, lines[i])
+		}
+	}
+
+	// Permissions are fixed without downloading.
+	os.Remove(hf.filename)
+	install("permissions", "permissions")
+	if err := os.Chmod(permissions, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout = new(bytes.Buffer)
+	v = Verifier{stdout: stdout, stderr: stderr, historyFilePath: hf.filename, fix: true}
+	if err := v.execute(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdout.String(), statusFixed) {
+		t.Fatalf("expected the mode to be fixed:\n%s", stdout)
+	}
+	if fi, _ := os.Stat(permissions); fi.Mode().Perm() != 0755 {
+		t.Fatalf("expected mode 0755, got %v", fi.Mode().Perm())
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"debug/buildinfo"
+	"debug/elf"
+	endian "encoding/binary"
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	versionProbeTimeout = 5 * time.Second
+	// packageNoteType is the note type of the package metadata some
+	// distributions embed in ".note.package" (https://systemd.io/ELF_PACKAGE_METADATA/).
+	packageNoteType = 0xcafe1a7e
+)
+
+var versionPattern = regexp.MustCompile(`\bv?\d+\.\d+(\.\d+)?([-+][0-9A-Za-z.-]+)?\b`)
+
+// pseudoVersionPattern matches Go pseudo-versions like
+// "v0.0.0-20240102150405-abcdef123456", the same as module.IsPseudoVersion.
+var pseudoVersionPattern = regexp.MustCompile(`^v[0-9]+\.(0\.0-|\d+\.\d+-([^+]*\.)?0\.)\d{14}-[A-Za-z0-9]+(\+[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?$`)
+
+// binaryVersion is the version found in a binary and where it came from.
+type binaryVersion struct {
+	version string
+	source  string
+}
+
+// detectVersion finds the version of the binary itself: the Go build info,
+// the ELF package note, or the output of versionArgs when they are given.
+func detectVersion(file string, versionArgs []string) (binaryVersion, bool) {
+	if info, err := buildinfo.ReadFile(file); err == nil && isModuleRelease(info.Main.Version) {
+		return binaryVersion{version: info.Main.Version, source: "build info"}, true
+	}
+
+	if v := elfNoteVersion(file); len(v) != 0 {
+		return binaryVersion{version: v, source: "ELF note"}, true
+	}
+
+	if len(versionArgs) != 0 {
+		if v := probeVersion(file, versionArgs...); len(v) != 0 {
+			return binaryVersion{version: v, source: strings.Join(versionArgs, " ")}, true
+		}
+	}
+
+	return binaryVersion{}, false
+}
+
+// versionArgsFor returns the arguments that print the version of the tool,
+// from "version_commands" in the config. "*" applies to every tool.
+func versionArgsFor(h *History) []string {
+	name := strings.TrimSuffix(filepath.Base(h.Path), ".exe")
+	if args, ok := cfg.VersionCommands[name]; ok {
+		return strings.Fields(args)
+	}
+	return strings.Fields(cfg.VersionCommands["*"])
+}
+
+// versionMismatch reports whether the binary of h is a different version
+// from the recorded tag.
+func (h *History) versionMismatch() (binaryVersion, bool) {
+	if len(h.Tag) == 0 {
+		return binaryVersion{}, false
+	}
+
+	v, ok := detectVersion(h.installedFile(), versionArgsFor(h))
+	if !ok {
+		return v, false
+	}
+	return v, !tagMatchesVersion(h.Tag, v.version)
+}
+
+// isModuleRelease reports whether the module version in Go build info is a
+// release, not "(devel)" or a pseudo-version no release has.
+func isModuleRelease(version string) bool {
+	return strings.HasPrefix(version, "v") && !pseudoVersionPattern.MatchString(version)
+}
+
+func tagMatchesVersion(tag, version string) bool {
+	_, ok := matchReleaseTag([]string{tag}, version)
+	return ok
+}
+
+// probeVersion runs the binary with args and returns the first version in
+// the output.
+func probeVersion(file string, args ...string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), versionProbeTimeout)
+	defer cancel()
+
+	out, _ := exec.CommandContext(ctx, file, args...).CombinedOutput()
+	return parseVersionOutput(string(out))
+}
+
+func parseVersionOutput(out string) string {
+	return versionPattern.FindString(out)
+}
+
+func elfNoteVersion(file string) string {
+	f, err := elf.Open(file)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	s := f.Section(".note.package")
+	if s == nil {
+		return ""
+	}
+	b, err := s.Data()
+	if err != nil {
+		return ""
+	}
+	return parsePackageNote(b, f.ByteOrder)
+}
+
+// parsePackageNote reads the version from the JSON payload of a package
+// metadata note.
+func parsePackageNote(b []byte, order endian.ByteOrder) string {
+	// Sizes are computed in uint64, so a crafted size can't wrap around.
+	align := func(n uint32) uint64 { return (uint64(n) + 3) &^ 3 }
+
+	for len(b) >= 12 {
+		nameSize := order.Uint32(b[0:4])
+		descSize := order.Uint32(b[4:8])
+		noteType := order.Uint32(b[8:12])
+		b = b[12:]
+
+		if align(nameSize)+uint64(descSize) > uint64(len(b)) {
+			return ""
+		}
+		name := string(bytes.TrimRight(b[:nameSize], "\x00"))
+		desc := bytes.TrimRight(b[align(nameSize):align(nameSize)+uint64(descSize)], "\x00")
+
+		if noteType == packageNoteType && name == "FDO" {
+			var metadata struct {
+				Version string `json:"version"`
+			}
+			if json.Unmarshal(desc, &metadata) == nil {
+				return metadata.Version
+			}
+		}
+
+		if align(nameSize)+align(descSize) > uint64(len(b)) {
+			return ""
+		}
+		b = b[align(nameSize)+align(descSize):]
+	}
+
+	return ""
+}
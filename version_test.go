@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	endian "encoding/binary"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestProbeVersion(t *testing.T) {
+	tests := []struct {
+		out  string
+		want string
+	}{
+		{"ripgrep 14.1.0\n\nfeatures:+pcre2", "14.1.0"},
+		{"fd 9.0.0", "9.0.0"},
+		{"Terraform v1.9.2\non linux_amd64", "v1.9.2"},
+		{"jq-1.7.1", "1.7.1"},
+		{"tool version 2.0.0-rc.1 (abc123)", "2.0.0-rc.1"},
+		{"usage: tool [options]", ""},
+	}
+
+	for _, tt := range tests {
+		if got := parseVersionOutput(tt.out); got != tt.want {
+			t.Fatalf("output: '%v', expected '%v', got '%v'", tt.out, tt.want, got)
+		}
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	file := filepath.Join(t.TempDir(), "tool")
+	if err := os.WriteFile(file, []byte("#!/bin/sh\necho \"tool version 1.4.0\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if got := probeVersion(file, "--version"); got != "1.4.0" {
+		t.Fatalf("expected '1.4.0', got '%v'", got)
+	}
+}
+
+func TestParsePackageNote(t *testing.T) {
+	note := func(name string, noteType uint32, desc string) []byte {
+		var b bytes.Buffer
+		pad := func(s string) []byte { return append([]byte(s), make([]byte, (4-len(s)%4)%4)...) }
+		endian.Write(&b, endian.LittleEndian, []uint32{uint32(len(name)), uint32(len(desc)), noteType})
+		b.Write(pad(name))
+		b.Write(pad(desc))
+		return b.Bytes()
+	}
+
+	buildID := note("GNU\x00", 3, "\x01\x02\x03\x04\x05")
+	pkg := note("FDO\x00", packageNoteType, `{"type":"rpm","name":"tool","version":"1.2.3-1.fc40"}`+"\x00")
+
+	tests := []struct {
+		data []byte
+		want string
+	}{
+		{append(buildID, pkg...), "1.2.3-1.fc40"},
+		{buildID, ""},
+		{pkg[:20], ""},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, 0x7e, 0x1a, 0xfe, 0xca, 'F', 'D', 'O', 0}, ""},
+		{[]byte{0xfd, 0xff, 0xff, 0xff, 0x04, 0, 0, 0, 0x7e, 0x1a, 0xfe, 0xca, 'F', 'D', 'O', 0}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := parsePackageNote(tt.data, endian.LittleEndian); got != tt.want {
+			t.Fatalf("expected '%v', got '%v'", tt.want, got)
+		}
+	}
+}
+
+func TestIsModuleRelease(t *testing.T) {
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{"v1.2.3", true},
+		{"v1.2.3-rc.1", true},
+		{"(devel)", false},
+		{"v0.0.0-20240102150405-abcdef123456", false},
+		{"v1.2.4-0.20240102150405-abcdef123456", false},
+		{"v1.2.3-pre.0.20240102150405-abcdef123456+dirty", false},
+	}
+
+	for _, tt := range tests {
+		if got := isModuleRelease(tt.version); got != tt.want {
+			t.Fatalf("%s: expected %v, got %v", tt.version, tt.want, got)
+		}
+	}
+}
+
+func TestVersionMismatch(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the binary is a shell script")
+	}
+
+	orig := cfg
+	defer func() { cfg = orig }()
+
+	tempDir := t.TempDir()
+	file := filepath.Join(tempDir, "tool")
+	if err := os.WriteFile(file, []byte("#!/bin/sh\necho \"tool 1.5.0\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	h := &History{URL: "https://github.com/owner/tool", Tag: "v1.4.0", Path: file}
+
+	// The version command isn't run unless it's configured.
+	if _, mismatch := h.versionMismatch(); mismatch {
+		t.Fatalf("expected no version to be detected")
+	}
+
+	cfg.VersionCommands = map[string]string{"tool": "--version"}
+	v, mismatch := h.versionMismatch()
+	if !mismatch || v.version != "1.5.0" || v.source != "--version" {
+		t.Fatalf("expected a mismatch with 1.5.0, got %+v (%v)", v, mismatch)
+	}
+
+	status, detail := checkInstall(h)
+	if status != statusModified || !strings.Contains(detail, "binary is 1.5.0") {
+		t.Fatalf("expected %v, got %v (%v)", statusModified, status, detail)
+	}
+
+	// With a matching checksum, the file is what obt installed.
+	addFileMetadata(h, file)
+	status, detail = checkInstall(h)
+	if status != statusVersion || isMismatch(status) || !strings.Contains(detail, "binary is 1.5.0") {
+		t.Fatalf("expected %v, got %v (%v)", statusVersion, status, detail)
+	}
+
+	h.Tag = "v1.5.0"
+	if _, mismatch := h.versionMismatch(); mismatch {
+		t.Fatalf("expected v1.5.0 to match")
+	}
+}
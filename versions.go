@@ -0,0 +1,239 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/olekukonko/tablewriter/tw"
+	"github.com/y-yagi/goext/osext"
+)
+
+// versionedPath returns where the release is installed with the versioned
+// layout. The bin path only has a symlink to it.
+func (d *Downloader) versionedPath() string {
+	return filepath.Join(d.dataPath, "tools", d.user, d.repository, d.releaseTag, d.executableName())
+}
+
+// linkBinary points link to target. The link is replaced atomically, so the
+// tool is never missing while switching versions.
+func linkBinary(target, link string) error {
+	tmp := link + ".obt-tmp"
+	os.Remove(tmp)
+
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// activateVersion makes target the version in use. A shim is kept as it is,
+// and the version it runs without a pinned one is recorded next to it.
+func activateVersion(target, link string) error {
+	if isShim(link) {
+		return writeActiveVersion(link, target)
+	}
+	return linkBinary(target, link)
+}
+
+func isSymlink(file string) bool {
+	fi, err := os.Lstat(file)
+	return err == nil && fi.Mode()&os.ModeSymlink != 0
+}
+
+// isActive reports whether the link of a versioned history points to it, or
+// whether it's the version recorded for the shim.
+func (h *History) isActive() bool {
+	if dest, err := os.Readlink(h.Path); err == nil {
+		return dest == h.Target
+	}
+	return isShim(h.Path) && readActiveVersion(h.Path) == h.Target
+}
+
+// matchTool reports whether h is an install of tool, given as the installed
+// file name, the repository or "owner/repository".
+func (h *History) matchTool(tool string) bool {
+	name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(h.Path), ".exe"), ".cmd")
+	return name == tool || strings.HasSuffix(h.URL, "/"+tool)
+}
+
+// findVersions returns the versioned installs of tool, newest first.
+func findVersions(histories map[string]*History, tool string) ([]*History, error) {
+	var versions []*History
+	paths := map[string]bool{}
+
+	for _, h := range histories {
+		if len(h.Target) == 0 || !h.matchTool(tool) {
+			continue
+		}
+		versions = append(versions, h)
+		paths[h.Path] = true
+	}
+
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("no versions of '%s' are installed. Please install it with '-versioned'", tool)
+	}
+
+	if len(paths) > 1 {
+		var list []string
+		for p := range paths {
+			list = append(list, p)
+		}
+		sort.Strings(list)
+		return nil, fmt.Errorf("'%s' is installed to several paths:\n  %s\nPlease specify the file name", tool, strings.Join(list, "\n  "))
+	}
+
+	sortVersions(versions)
+	return versions, nil
+}
+
+// sortVersions sorts histories newest first.
+func sortVersions(versions []*History) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		return compareTags(versions[i].Tag, versions[j].Tag) > 0
+	})
+}
+
+func showVersions(stdout io.Writer, args []string) error {
+	if len(args) != 1 {
+		return errors.New("please specify a tool. Usage: obt versions <tool>")
+	}
+
+	hf := HistoryFile{filename: determineHistoryFilePath()}
+	histories, err := hf.load()
+	if err != nil {
+		return err
+	}
+
+	versions, err := findVersions(histories, args[0])
+	if err != nil {
+		return err
+	}
+
+	table := tablewriter.NewTable(stdout, tablewriter.WithSymbols(tw.NewSymbols(tw.StyleASCII)))
+	table.Header("TAG", "ACTIVE", "PATH")
+
+	for _, h := range versions {
+		active := ""
+		if h.isActive() {
+			active = "*"
+		}
+
+		err := table.Append([]string{h.Tag, active, h.Target})
+		if err != nil {
+			return err
+		}
+	}
+
+	return table.Render()
+}
+
+func useVersion(stdout io.Writer, args []string) error {
+	if len(args) != 2 {
+		return errors.New("please specify a tool and a tag. Usage: obt use <tool> <tag>")
+	}
+	tool, tag := args[0], args[1]
+
+	hf := HistoryFile{filename: determineHistoryFilePath()}
+	histories, err := hf.load()
+	if err != nil {
+		return err
+	}
+
+	versions, err := findVersions(histories, tool)
+	if err != nil {
+		return err
+	}
+
+	for _, h := range versions {
+		if h.Tag != tag && h.Tag != "v"+tag {
+			continue
+		}
+
+		if !osext.IsExist(h.Target) {
+			return fmt.Errorf("'%s' doesn't exist. Please install '%s' again with '-versioned -tag %s'", h.Target, tool, h.Tag)
+		}
+		if osext.IsExist(h.Path) && !isSymlink(h.Path) && !isShim(h.Path) {
+			return fmt.Errorf("'%s' isn't a symlink or a shim managed by obt", h.Path)
+		}
+
+		if err := activateVersion(h.Target, h.Path); err != nil {
+			return err
+		}
+		// The receipt of the link names the version in use.
+		if err := writeReceipt(h); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "'%s' now uses '%s'.\n", h.Path, h.Tag)
+		return nil
+	}
+
+	return fmt.Errorf("'%s' %s isn't installed. Please install it with '-versioned -tag %s'", tool, tag, tag)
+}
+
+// compareTags compares release tags like "v1.10.0" and "v1.9.2", comparing
+// numeric parts as numbers.
+func compareTags(a, b string) int {
+	pa, pb := splitTag(a), splitTag(b)
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		if pa[i] == pb[i] {
+			continue
+		}
+
+		na, errA := strconv.Atoi(pa[i])
+		nb, errB := strconv.Atoi(pb[i])
+		if errA == nil && errB == nil {
+			if na < nb {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(pa[i], pb[i])
+	}
+
+	switch {
+	case len(pa) < len(pb):
+		return -1
+	case len(pa) > len(pb):
+		return 1
+	}
+	return 0
+}
+
+func splitTag(tag string) []string {
+	var parts []string
+	var current []rune
+	digit := false
+
+	for _, r := range strings.TrimPrefix(tag, "v") {
+		isDigit := unicode.IsDigit(r)
+		if len(current) > 0 && isDigit != digit {
+			parts = append(parts, string(current))
+			current = nil
+		}
+		if r == '.' || r == '-' || r == '+' || r == '_' {
+			if len(current) > 0 {
+				parts = append(parts, string(current))
+			}
+			current = nil
+			continue
+		}
+		current = append(current, r)
+		digit = isDigit
+	}
+	if len(current) > 0 {
+		parts = append(parts, string(current))
+	}
+	return parts
+}